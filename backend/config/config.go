@@ -3,11 +3,16 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// DefaultJWTSecret is the development fallback for JWT_SECRET; it must not be used in production
+const DefaultJWTSecret = "default-secret-key"
+
 type Config struct {
 	Port            string
 	Env             string
@@ -19,6 +24,66 @@ type Config struct {
 	GoogleClientSecret string
 	GoogleRedirectURL  string
 	FrontendURL     string
+	APIURL             string
+	TOTPIssuer         string
+
+	// Token signing
+	JWTAlgorithm            string   // "HS256", "RS256" or "EdDSA"
+	JWTPrivateKeyFile       string   // PEM private key for RS256/EdDSA
+	JWTVerificationKeyFiles []string // PEM keys of retired signing keys still accepted during rotation
+
+	// Email delivery
+	MailDriver               string // "smtp", "file" or "log"
+	MailFrom                 string
+	MailDir                  string
+	SMTPHost                 string
+	SMTPPort                 string
+	SMTPUsername             string
+	SMTPPassword             string
+	RequireEmailVerification bool
+
+	// Login brute-force protection
+	LoginMaxAttempts     int           // failed attempts per account before a lockout
+	LoginIPMaxAttempts   int           // failed attempts per IP before a lockout
+	LoginAttemptWindow   time.Duration // how long failed attempts are remembered
+	LoginLockoutDuration time.Duration // first lockout; doubles on each repeat
+	LoginMaxLockout      time.Duration
+
+	// End-to-end encryption
+	PreKeyClaimMaxAttempts int           // prekey bundle claims per user for another user's devices within the window
+	PreKeyClaimWindow      time.Duration // also how long further claims are refused once the limit is hit
+
+	// Server administrators
+	AdminEmails []string // accounts granted the admin role at startup
+
+	// Account deletion
+	AccountDeletionGracePeriod time.Duration // how long a deletion can still be cancelled by signing in
+
+	// Uploaded and generated images
+	MediaDir      string // where avatars and group icons are stored
+	MaxUploadSize int    // largest accepted image upload, in bytes
+
+	// Generated unique IDs, like #WAVE-7K3QX9
+	UniqueIDPrefixes []string // one is picked at random for each ID
+	UniqueIDLength   int      // random characters after the prefix
+
+	// Additional OAuth/OIDC sign-in providers
+	OAuthProviders []OAuthProviderConfig
+}
+
+// OAuthProviderConfig configures a single OAuth 2.0 / OpenID Connect provider.
+// When Issuer is set, endpoints are found via OIDC discovery; explicit URLs take precedence.
+type OAuthProviderConfig struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Issuer       string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	EmailsURL    string // GitHub-style list of the user's addresses, for providers whose userinfo lacks a verified email
+	Scopes       []string
 }
 
 var AppConfig *Config
@@ -39,13 +104,104 @@ func Load() {
 		Env:             getEnv("ENV", "development"),
 		MongoDBURI:      getEnv("MONGODB_URI", ""),
 		MongoDBDatabase: getEnv("MONGODB_DATABASE", "go_webchat"),
-		JWTSecret:       getEnv("JWT_SECRET", "default-secret-key"),
+		JWTSecret:       getEnv("JWT_SECRET", DefaultJWTSecret),
 		JWTExpiry:       jwtExpiry,
 		GoogleClientID:  getEnv("GOOGLE_CLIENT_ID", ""),
 		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
 		GoogleRedirectURL:  getEnv("GOOGLE_REDIRECT_URL", "http://localhost:8080/api/auth/google/callback"),
 		FrontendURL:     getEnv("FRONTEND_URL", "http://localhost:3000"),
+		APIURL:             getEnv("API_URL", "http://localhost:8080"),
+		TOTPIssuer:         getEnv("TOTP_ISSUER", "Go WebChat"),
+
+		JWTAlgorithm:            getEnv("JWT_ALGORITHM", "HS256"),
+		JWTPrivateKeyFile:       getEnv("JWT_PRIVATE_KEY_FILE", ""),
+		JWTVerificationKeyFiles: splitList(getEnv("JWT_VERIFICATION_KEY_FILES", "")),
+
+		MailDriver:               getEnv("MAIL_DRIVER", "log"),
+		MailFrom:                 getEnv("MAIL_FROM", "Go WebChat <no-reply@localhost>"),
+		MailDir:                  getEnv("MAIL_DIR", "./mail"),
+		SMTPHost:                 getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:                 getEnv("SMTP_PORT", "587"),
+		SMTPUsername:             getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:             getEnv("SMTP_PASSWORD", ""),
+		RequireEmailVerification: getEnv("REQUIRE_EMAIL_VERIFICATION", "false") == "true",
+
+		LoginMaxAttempts:     getEnvInt("LOGIN_MAX_ATTEMPTS", 5),
+		LoginIPMaxAttempts:   getEnvInt("LOGIN_IP_MAX_ATTEMPTS", 20),
+		LoginAttemptWindow:   getEnvDuration("LOGIN_ATTEMPT_WINDOW", 15*time.Minute),
+		LoginLockoutDuration: getEnvDuration("LOGIN_LOCKOUT_DURATION", time.Minute),
+		LoginMaxLockout:      getEnvDuration("LOGIN_MAX_LOCKOUT", time.Hour),
+
+		PreKeyClaimMaxAttempts: getEnvInt("PREKEY_CLAIM_MAX_ATTEMPTS", 10),
+		PreKeyClaimWindow:      getEnvDuration("PREKEY_CLAIM_WINDOW", time.Hour),
+
+		AdminEmails: splitList(getEnv("ADMIN_EMAILS", "")),
+
+		AccountDeletionGracePeriod: getEnvDuration("ACCOUNT_DELETION_GRACE_PERIOD", 14*24*time.Hour),
+
+		MediaDir:      getEnv("MEDIA_DIR", "./uploads"),
+		MaxUploadSize: getEnvInt("MAX_UPLOAD_SIZE", 5*1024*1024),
+
+		UniqueIDPrefixes: splitList(getEnv("UNIQUE_ID_PREFIXES", "CHAT,USER,TALK,GOPRO,WAVE,PING")),
+		UniqueIDLength:   getEnvInt("UNIQUE_ID_LENGTH", 6),
+	}
+
+	AppConfig.OAuthProviders = loadOAuthProviders()
+}
+
+// loadOAuthProviders reads providers listed in OAUTH_PROVIDERS, e.g. "gitlab,keycloak",
+// each configured with OAUTH_<NAME>_* variables
+func loadOAuthProviders() []OAuthProviderConfig {
+	providers := []OAuthProviderConfig{}
+
+	for _, name := range splitList(getEnv("OAUTH_PROVIDERS", "")) {
+		name = strings.ToLower(name)
+		prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+
+		providers = append(providers, OAuthProviderConfig{
+			Name:         name,
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", ""),
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			AuthURL:      getEnv(prefix+"AUTH_URL", ""),
+			TokenURL:     getEnv(prefix+"TOKEN_URL", ""),
+			UserInfoURL:  getEnv(prefix+"USERINFO_URL", ""),
+			EmailsURL:    getEnv(prefix+"EMAILS_URL", ""),
+			Scopes:       splitList(getEnv(prefix+"SCOPES", "")),
+		})
+	}
+
+	return providers
+}
+
+// getEnvInt reads an integer variable, falling back to the default if unset or invalid
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvDuration reads a duration variable such as "15m", falling back to the default if unset or invalid
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// splitList splits a comma-separated value, dropping empty entries
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
 
 func getEnv(key, defaultValue string) string {
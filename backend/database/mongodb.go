@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/vinneth/go-webchat/config"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -21,6 +22,17 @@ var (
 	Users         *mongo.Collection
 	Conversations *mongo.Collection
 	Messages      *mongo.Collection
+	Sessions      *mongo.Collection
+
+	TwoFactorChallenges *mongo.Collection
+	Throttles           *mongo.Collection
+	APIKeys             *mongo.Collection
+	WSTickets           *mongo.Collection
+	DeviceKeys          *mongo.Collection
+	ContactRequests     *mongo.Collection
+	ContactInvites      *mongo.Collection
+	GroupInvites        *mongo.Collection
+	GroupJoinRequests   *mongo.Collection
 )
 
 func Connect() error {
@@ -50,11 +62,163 @@ func Connect() error {
 	Users = Database.Collection("users")
 	Conversations = Database.Collection("conversations")
 	Messages = Database.Collection("messages")
+	Sessions = Database.Collection("sessions")
+	TwoFactorChallenges = Database.Collection("two_factor_challenges")
+	Throttles = Database.Collection("login_throttles") // Named for its first use; holds every throttle
+	APIKeys = Database.Collection("api_keys")
+	WSTickets = Database.Collection("ws_tickets")
+	DeviceKeys = Database.Collection("device_keys")
+	ContactRequests = Database.Collection("contact_requests")
+	ContactInvites = Database.Collection("contact_invites")
+	GroupInvites = Database.Collection("group_invites")
+	GroupJoinRequests = Database.Collection("group_join_requests")
 
 	log.Println("✅ Connected to MongoDB Atlas")
 	return nil
 }
 
+// EnsureIndexes creates the indexes the application relies on. It runs after the migrations
+// that fix data the indexes would reject, such as duplicate unique IDs.
+func EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := Users.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// An external identity can only be linked to one user
+		{
+			Keys: bson.D{
+				{Key: "identities.provider", Value: 1},
+				{Key: "identities.subject", Value: 1},
+			},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"identities.subject": bson.M{"$exists": true}}),
+		},
+		// No two users can share a unique ID
+		{Keys: bson.D{{Key: "unique_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		// Prefix search on the words of display names
+		{Keys: bson.D{{Key: "name_search", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Expired sessions are removed by MongoDB automatically
+	_, err = Sessions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = TwoFactorChallenges.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = Throttles.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = APIKeys.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "bot_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = WSTickets.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = DeviceKeys.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "user_id", Value: 1},
+			{Key: "device_id", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Only one pending request per direction
+	_, err = ContactRequests.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "from_id", Value: 1},
+				{Key: "to_id", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "to_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Invite links are looked up by token; expired ones are removed by MongoDB automatically
+	_, err = ContactInvites.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Group invite links work the same way
+	_, err = GroupInvites.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "group_id", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Only one pending join request per user and group
+	_, err = GroupJoinRequests.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "group_id", Value: 1},
+				{Key: "user_id", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	return err
+}
+
 func Disconnect() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/config"
+	"github.com/vinneth/go-webchat/media"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"github.com/vinneth/go-webchat/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DeleteAccountRequest represents delete account payload
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"` // Required when 2FA is enabled
+}
+
+// ExportAccount returns a zip archive of the user's personal data
+func ExportAccount(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	contacts, err := models.GetContacts(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to export contacts",
+		})
+	}
+	contactsDetails := make([]ContactDetails, 0, len(contacts))
+	for i := range contacts {
+		if details, ok := contactDetails(user, &contacts[i]); ok {
+			details.IsOnline = false
+			contactsDetails = append(contactsDetails, details)
+		}
+	}
+	contactLists := user.ContactLists
+	if contactLists == nil {
+		contactLists = []models.ContactList{}
+	}
+
+	conversations, err := models.GetUserConversations(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to export conversations",
+		})
+	}
+
+	messages, err := models.GetMessagesBySender(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to export messages",
+		})
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user},
+		{"contacts.json", contactsDetails},
+		{"contact_lists.json", contactLists},
+		{"conversations.json", conversations},
+		{"messages.json", messages},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err == nil {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(file.data)
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to build export",
+			})
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to build export",
+		})
+	}
+
+	filename := fmt.Sprintf("webchat-export-%s.zip", time.Now().Format("2006-01-02"))
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Send(buf.Bytes())
+}
+
+// DeleteAccount schedules the user's account for deletion and signs them out everywhere.
+// Signing in again before the grace period ends cancels the deletion.
+func DeleteAccount(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req DeleteAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	// Re-check credentials before scheduling the deletion
+	if user.HasPassword() && !models.CheckPassword(req.Password, user.PasswordHash) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid password",
+		})
+	}
+	if user.TwoFactor.Enabled {
+		valid, err := models.VerifyTwoFactorCode(user, req.Code, true)
+		if err != nil || !valid {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid authentication code",
+			})
+		}
+	}
+
+	deletionAt := time.Now().Add(config.AppConfig.AccountDeletionGracePeriod)
+	if err := models.ScheduleAccountDeletion(userID, deletionAt); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to schedule account deletion",
+		})
+	}
+
+	// Sign out everywhere
+	models.RevokeAllSessions(userID)
+	websocket.Hub.DisconnectUser(userID)
+	middleware.ClearAuthCookie(c)
+
+	return c.JSON(fiber.Map{
+		"message":     "Your account will be deleted. Sign in again before then to cancel.",
+		"deletion_at": deletionAt,
+	})
+}
+
+// purgeAccount permanently deletes an account whose grace period has ended
+func purgeAccount(user *models.User) error {
+	if err := models.RevokeAllSessions(user.ID); err != nil {
+		return err
+	}
+	websocket.Hub.DisconnectUser(user.ID)
+
+	if err := models.RemoveFromAllContacts(user.ID); err != nil {
+		return err
+	}
+
+	if err := models.DeleteAllDeviceKeys(user.ID); err != nil {
+		return err
+	}
+
+	if err := models.DeleteUserContactRequests(user.ID); err != nil {
+		return err
+	}
+
+	if err := models.DeleteUserContactInvites(user.ID); err != nil {
+		return err
+	}
+
+	if err := models.DeleteUserGroupJoinRequests(user.ID); err != nil {
+		return err
+	}
+
+	// Bots can't outlive their owner
+	bots, err := models.GetOwnedBots(user.ID)
+	if err != nil {
+		return err
+	}
+	for _, bot := range bots {
+		if err := models.DeleteBot(bot.ID); err != nil {
+			return err
+		}
+		websocket.Hub.DisconnectUser(bot.ID)
+	}
+
+	conversations, err := models.GetUserConversations(user.ID)
+	if err != nil {
+		return err
+	}
+	for _, conv := range conversations {
+		if conv.Type != models.ConversationTypeGroup {
+			// Private chats stay with the other participant
+			continue
+		}
+		if err := leaveGroupOnDeletion(&conv, user.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := models.AnonymizeUser(user.ID); err != nil {
+		return err
+	}
+	return media.Delete(media.KindAvatar, user.AvatarMedia)
+}
+
+// leaveGroupOnDeletion removes a deleted user from a group, handing over or deleting groups they own
+func leaveGroupOnDeletion(group *models.Conversation, userID primitive.ObjectID) error {
+	remaining := make([]primitive.ObjectID, 0, len(group.Members))
+	for _, memberID := range group.Members {
+		if memberID != userID {
+			remaining = append(remaining, memberID)
+		}
+	}
+
+	if group.Owner == userID {
+		newOwner := nextGroupOwner(group, remaining)
+		if newOwner.IsZero() {
+			// Nobody left to run the group
+			if err := models.DeleteConversation(group.ID); err != nil {
+				return err
+			}
+			media.Delete(media.KindGroupIcon, group.IconMedia)
+			for _, memberID := range remaining {
+				websocket.Hub.SendToUser(memberID, websocket.WSMessage{
+					Type: "group:removed",
+					Payload: map[string]interface{}{
+						"group_id": group.ID,
+					},
+				})
+			}
+			return nil
+		}
+
+		if err := models.SetGroupOwner(group.ID, newOwner); err != nil {
+			return err
+		}
+		for _, memberID := range remaining {
+			websocket.Hub.SendToUser(memberID, websocket.WSMessage{
+				Type: "group:owner_changed",
+				Payload: map[string]interface{}{
+					"group_id":          group.ID,
+					"owner_id":          newOwner,
+					"previous_owner_id": userID,
+				},
+			})
+		}
+	}
+
+	if err := models.RemoveGroupMember(group.ID, userID); err != nil {
+		return err
+	}
+
+	for _, memberID := range remaining {
+		websocket.Hub.SendToUser(memberID, websocket.WSMessage{
+			Type: "group:member_left",
+			Payload: map[string]interface{}{
+				"group_id":  group.ID,
+				"member_id": userID,
+			},
+		})
+	}
+	return nil
+}
+
+// nextGroupOwner picks the longest-standing human admin, or failing that the longest-standing human member
+func nextGroupOwner(group *models.Conversation, members []primitive.ObjectID) primitive.ObjectID {
+	var fallback primitive.ObjectID
+	for _, memberID := range members {
+		member, err := models.FindUserByID(memberID)
+		if err != nil || member == nil || member.IsBot || member.Deleted {
+			continue
+		}
+		if group.RoleOf(memberID) == models.GroupRoleAdmin {
+			return memberID
+		}
+		if fallback.IsZero() {
+			fallback = memberID
+		}
+	}
+	return fallback
+}
+
+// PurgeDeletedAccounts deletes every account whose grace period has ended
+func PurgeDeletedAccounts() {
+	users, err := models.GetAccountsDueForDeletion()
+	if err != nil {
+		log.Printf("Failed to load accounts due for deletion: %v", err)
+		return
+	}
+
+	for i := range users {
+		if err := purgeAccount(&users[i]); err != nil {
+			log.Printf("Failed to delete account %s: %v", users[i].ID.Hex(), err)
+			continue
+		}
+		log.Printf("Deleted account %s", users[i].ID.Hex())
+	}
+}
+
+// RunAccountPurger periodically purges accounts whose grace period has ended
+func RunAccountPurger(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		PurgeDeletedAccounts()
+		<-ticker.C
+	}
+}
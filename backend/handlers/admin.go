@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/media"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"github.com/vinneth/go-webchat/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SuspendUserRequest represents suspend user payload
+type SuspendUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+// SetRoleRequest represents set role payload
+type SetRoleRequest struct {
+	Role string `json:"role"` // "admin", or empty to remove the role
+}
+
+// AdminUser is a user as shown to administrators
+type AdminUser struct {
+	models.User
+	IsOnline bool `json:"is_online"`
+}
+
+// findAdminTarget loads the user named in the route
+func findAdminTarget(c *fiber.Ctx) (*models.User, error) {
+	targetID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	target, err := models.FindUserByID(targetID)
+	if err != nil || target == nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	return target, nil
+}
+
+// AdminListUsers lists and searches all users
+func AdminListUsers(c *fiber.Ctx) error {
+	// Pagination
+	limit, _ := strconv.ParseInt(c.Query("limit", "50"), 10, 64)
+	skip, _ := strconv.ParseInt(c.Query("skip", "0"), 10, 64)
+
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+	if skip < 0 {
+		skip = 0
+	}
+
+	users, total, err := models.SearchUsers(c.Query("q"), c.QueryBool("suspended"), skip, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch users",
+		})
+	}
+
+	result := make([]AdminUser, 0, len(users))
+	for _, user := range users {
+		result = append(result, AdminUser{User: user, IsOnline: websocket.Hub.IsOnline(user.ID)})
+	}
+
+	return c.JSON(fiber.Map{
+		"users": result,
+		"total": total,
+	})
+}
+
+// AdminGetUser returns a single user
+func AdminGetUser(c *fiber.Ctx) error {
+	target, err := findAdminTarget(c)
+	if target == nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"user": AdminUser{User: *target, IsOnline: websocket.Hub.IsOnline(target.ID)},
+	})
+}
+
+// AdminSuspendUser suspends an account and signs it out everywhere
+func AdminSuspendUser(c *fiber.Ctx) error {
+	adminID := middleware.GetUserID(c)
+
+	target, err := findAdminTarget(c)
+	if target == nil {
+		return err
+	}
+
+	if target.ID == adminID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You cannot suspend yourself",
+		})
+	}
+
+	var req SuspendUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := models.SuspendUser(target.ID, adminID, req.Reason); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to suspend user",
+		})
+	}
+
+	models.RevokeAllSessions(target.ID)
+	websocket.Hub.DisconnectUser(target.ID)
+
+	log.Printf("Admin %s suspended user %s: %s", adminID.Hex(), target.ID.Hex(), req.Reason)
+
+	return c.JSON(fiber.Map{
+		"message": "User suspended successfully",
+	})
+}
+
+// AdminUnsuspendUser lifts an account's suspension
+func AdminUnsuspendUser(c *fiber.Ctx) error {
+	adminID := middleware.GetUserID(c)
+
+	target, err := findAdminTarget(c)
+	if target == nil {
+		return err
+	}
+
+	if err := models.UnsuspendUser(target.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unsuspend user",
+		})
+	}
+
+	log.Printf("Admin %s unsuspended user %s", adminID.Hex(), target.ID.Hex())
+
+	return c.JSON(fiber.Map{
+		"message": "User unsuspended successfully",
+	})
+}
+
+// AdminLogoutUser revokes all of a user's sessions and closes their connections
+func AdminLogoutUser(c *fiber.Ctx) error {
+	adminID := middleware.GetUserID(c)
+
+	target, err := findAdminTarget(c)
+	if target == nil {
+		return err
+	}
+
+	if err := models.RevokeAllSessions(target.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke sessions",
+		})
+	}
+	websocket.Hub.DisconnectUser(target.ID)
+
+	log.Printf("Admin %s signed out user %s", adminID.Hex(), target.ID.Hex())
+
+	return c.JSON(fiber.Map{
+		"message": "User signed out everywhere",
+	})
+}
+
+// AdminSetUserRole grants or removes the admin role
+func AdminSetUserRole(c *fiber.Ctx) error {
+	adminID := middleware.GetUserID(c)
+
+	target, err := findAdminTarget(c)
+	if target == nil {
+		return err
+	}
+
+	var req SetRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Role != "" && req.Role != models.RoleAdmin {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unknown role",
+		})
+	}
+
+	if target.ID == adminID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You cannot change your own role",
+		})
+	}
+
+	if target.IsBot && req.Role != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Bots cannot be administrators",
+		})
+	}
+
+	if err := models.SetUserRole(target.ID, req.Role); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update role",
+		})
+	}
+
+	log.Printf("Admin %s set role of user %s to %q", adminID.Hex(), target.ID.Hex(), req.Role)
+
+	return c.JSON(fiber.Map{
+		"message": "Role updated successfully",
+	})
+}
+
+// AdminGetGroup returns any group's metadata, without its messages
+func AdminGetGroup(c *fiber.Ctx) error {
+	groupID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid group ID",
+		})
+	}
+
+	group, err := models.FindConversationByID(groupID)
+	if err != nil || group == nil || group.Type != models.ConversationTypeGroup {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Group not found",
+		})
+	}
+
+	membersList := make([]models.UserPublic, 0, len(group.Members))
+	for _, memberID := range group.Members {
+		member, _ := models.FindUserByID(memberID)
+		if member != nil {
+			membersList = append(membersList, member.ToPublic(websocket.Hub.IsOnline(member.ID)))
+		}
+	}
+
+	messageCount, _ := models.CountMessages(groupID)
+
+	return c.JSON(fiber.Map{
+		"group": models.ConversationWithDetails{
+			Conversation: *group,
+			MembersList:  membersList,
+		},
+		"message_count": messageCount,
+	})
+}
+
+// AdminDeleteGroup deletes a group and all of its messages
+func AdminDeleteGroup(c *fiber.Ctx) error {
+	adminID := middleware.GetUserID(c)
+
+	groupID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid group ID",
+		})
+	}
+
+	group, err := models.FindConversationByID(groupID)
+	if err != nil || group == nil || group.Type != models.ConversationTypeGroup {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Group not found",
+		})
+	}
+
+	if err := models.DeleteConversation(groupID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete group",
+		})
+	}
+	media.Delete(media.KindGroupIcon, group.IconMedia)
+
+	// Notify members
+	for _, memberID := range group.Members {
+		websocket.Hub.SendToUser(memberID, websocket.WSMessage{
+			Type: "group:removed",
+			Payload: map[string]interface{}{
+				"group_id": groupID,
+			},
+		})
+	}
+
+	log.Printf("Admin %s deleted group %s", adminID.Hex(), groupID.Hex())
+
+	return c.JSON(fiber.Map{
+		"message": "Group deleted successfully",
+	})
+}
+
+// AdminDeleteMessage removes a message from any conversation
+func AdminDeleteMessage(c *fiber.Ctx) error {
+	adminID := middleware.GetUserID(c)
+
+	msgID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid message ID",
+		})
+	}
+
+	msg, err := models.FindMessageByID(msgID)
+	if err != nil || msg == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Message not found",
+		})
+	}
+
+	if err := models.DeleteMessage(msgID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete message",
+		})
+	}
+	models.UnpinMessage(msg.ConversationID, msgID)
+
+	// Notify conversation members
+	websocket.Hub.BroadcastToConversation(msg.ConversationID, websocket.WSMessage{
+		Type: "message:deleted",
+		Payload: map[string]interface{}{
+			"conversation_id": msg.ConversationID,
+			"message_id":      msgID,
+		},
+	}, nil)
+
+	log.Printf("Admin %s deleted message %s from user %s", adminID.Hex(), msgID.Hex(), msg.SenderID.Hex())
+
+	return c.JSON(fiber.Map{
+		"message": "Message deleted successfully",
+	})
+}
@@ -1,17 +1,12 @@
 package handlers
 
 import (
-	"context"
-	"encoding/json"
-	"fmt"
-	"io"
+	"log"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/vinneth/go-webchat/config"
 	"github.com/vinneth/go-webchat/middleware"
 	"github.com/vinneth/go-webchat/models"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
+	"github.com/vinneth/go-webchat/websocket"
 )
 
 // RegisterRequest represents registration payload
@@ -30,22 +25,9 @@ type LoginRequest struct {
 
 // AuthResponse represents authentication response
 type AuthResponse struct {
-	Message string             `json:"message"`
-	User    *models.UserPublic `json:"user"`
-}
-
-// Google OAuth config
-func getGoogleOAuthConfig() *oauth2.Config {
-	return &oauth2.Config{
-		ClientID:     config.AppConfig.GoogleClientID,
-		ClientSecret: config.AppConfig.GoogleClientSecret,
-		RedirectURL:  config.AppConfig.GoogleRedirectURL,
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.email",
-			"https://www.googleapis.com/auth/userinfo.profile",
-		},
-		Endpoint: google.Endpoint,
-	}
+	Message   string             `json:"message"`
+	User      *models.UserPublic `json:"user"`
+	CSRFToken string             `json:"csrf_token,omitempty"` // Send as X-CSRF-Token on cookie-authenticated requests
 }
 
 // Register handles user registration
@@ -91,7 +73,6 @@ func Register(c *fiber.Ctx) error {
 		Email:        req.Email,
 		PasswordHash: hashedPassword,
 		Name:         req.Name,
-		Avatar:       fmt.Sprintf("https://api.dicebear.com/7.x/initials/svg?seed=%s", req.Name),
 		AuthProvider: "local",
 	}
 
@@ -101,20 +82,23 @@ func Register(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate JWT
-	token, err := middleware.GenerateToken(user.ID, user.Email)
+	// Start session and set cookie
+	csrfToken, err := startSession(c, user, false)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate token",
 		})
 	}
 
-	// Set cookie
-	middleware.SetAuthCookie(c, token, false)
+	// Ask the user to confirm their address
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("Failed to send verification email: %v", err)
+	}
 
 	return c.Status(fiber.StatusCreated).JSON(AuthResponse{
-		Message: "Registration successful",
-		User:    &models.UserPublic{ID: user.ID, UniqueID: user.UniqueID, Name: user.Name, Avatar: user.Avatar},
+		Message:   "Registration successful",
+		User:      &models.UserPublic{ID: user.ID, UniqueID: user.UniqueID, Name: user.Name, Avatar: user.Avatar},
+		CSRFToken: csrfToken,
 	})
 }
 
@@ -133,43 +117,80 @@ func Login(c *fiber.Ctx) error {
 		})
 	}
 
-	// Find user
+	// Count the attempt before checking the password, so parallel guesses can't get past the limit
 	user, err := models.FindUserByEmail(req.Email)
-	if err != nil || user == nil {
+	if err != nil {
+		user = nil
+	}
+	if lockout := countLoginAttempt(c, req.Email, user); lockout > 0 {
+		return tooManyAttempts(c, lockout)
+	}
+
+	if user == nil || !models.CheckPassword(req.Password, user.PasswordHash) {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid email or password",
 		})
 	}
 
-	// Check password
-	if !models.CheckPassword(req.Password, user.PasswordHash) {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid email or password",
+	loginSucceeded(c, req.Email)
+
+	if user.IsSuspended() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Your account has been suspended",
+		})
+	}
+
+	// Require a second factor before starting a session
+	if user.TwoFactor.Enabled {
+		challenge, err := models.CreateTwoFactorChallenge(user.ID, req.RememberMe)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to start two-factor authentication",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"message":             "Two-factor authentication required",
+			"two_factor_required": true,
+			"challenge":           challenge,
+			"expires_in":          int(models.TwoFactorChallengeTTL.Seconds()),
 		})
 	}
 
-	// Generate JWT
-	token, err := middleware.GenerateToken(user.ID, user.Email)
+	// Start session and set cookie
+	csrfToken, err := startSession(c, user, req.RememberMe)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate token",
 		})
 	}
 
-	// Set cookie
-	middleware.SetAuthCookie(c, token, req.RememberMe)
-
 	// Update last seen
 	models.UpdateLastSeen(user.ID)
 
 	return c.JSON(AuthResponse{
-		Message: "Login successful",
-		User:    &models.UserPublic{ID: user.ID, UniqueID: user.UniqueID, Name: user.Name, Avatar: user.Avatar},
+		Message:   "Login successful",
+		User:      &models.UserPublic{ID: user.ID, UniqueID: user.UniqueID, Name: user.Name, Avatar: user.Avatar},
+		CSRFToken: csrfToken,
 	})
 }
 
 // Logout handles user logout
 func Logout(c *fiber.Ctx) error {
+	// Revoke the current session if the token is still valid
+	if tokenString := middleware.TokenFromRequest(c); tokenString != "" {
+		if _, session, err := middleware.Authenticate(tokenString); err == nil {
+			// Like AuthRequired, so another site can't sign the user out through their cookie
+			if c.Cookies("auth_token") == tokenString && !middleware.ValidCSRF(c, session) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Invalid or missing CSRF token",
+				})
+			}
+			models.RevokeSession(session.UserID, session.ID)
+			websocket.Hub.DisconnectSession(session.ID)
+		}
+	}
+
 	middleware.ClearAuthCookie(c)
 	return c.JSON(fiber.Map{
 		"message": "Logged out successfully",
@@ -201,88 +222,15 @@ func GetMe(c *fiber.Ctx) error {
 			UniqueID: user.UniqueID,
 			Name:     user.Name,
 			Avatar:   user.Avatar,
-			LastSeen: user.LastSeen,
+			Bio:      user.Bio,
+			LastSeen: &user.LastSeen,
 		},
+		"email_verified":     user.EmailVerified,
+		"two_factor_enabled": user.TwoFactor.Enabled,
+		"privacy":            user.Privacy.WithDefaults(),
 	})
 }
 
-// GoogleLogin redirects to Google OAuth
-func GoogleLogin(c *fiber.Ctx) error {
-	oauthConfig := getGoogleOAuthConfig()
-	url := oauthConfig.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	return c.Redirect(url)
-}
-
-// GoogleCallback handles Google OAuth callback
-func GoogleCallback(c *fiber.Ctx) error {
-	code := c.Query("code")
-	if code == "" {
-		return c.Redirect(config.AppConfig.FrontendURL + "/login?error=no_code")
-	}
-
-	oauthConfig := getGoogleOAuthConfig()
-	token, err := oauthConfig.Exchange(context.Background(), code)
-	if err != nil {
-		return c.Redirect(config.AppConfig.FrontendURL + "/login?error=exchange_failed")
-	}
-
-	// Get user info from Google
-	client := oauthConfig.Client(context.Background(), token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
-	if err != nil {
-		return c.Redirect(config.AppConfig.FrontendURL + "/login?error=userinfo_failed")
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return c.Redirect(config.AppConfig.FrontendURL + "/login?error=read_failed")
-	}
-
-	var googleUser struct {
-		ID      string `json:"id"`
-		Email   string `json:"email"`
-		Name    string `json:"name"`
-		Picture string `json:"picture"`
-	}
-
-	if err := json.Unmarshal(body, &googleUser); err != nil {
-		return c.Redirect(config.AppConfig.FrontendURL + "/login?error=parse_failed")
-	}
-
-	// Find or create user
-	user, _ := models.FindUserByEmail(googleUser.Email)
-	if user == nil {
-		// Create new user
-		user = &models.User{
-			Email:        googleUser.Email,
-			Name:         googleUser.Name,
-			Avatar:       googleUser.Picture,
-			AuthProvider: "google",
-		}
-		if err := models.CreateUser(user); err != nil {
-			return c.Redirect(config.AppConfig.FrontendURL + "/login?error=create_failed")
-		}
-	} else {
-		// Update avatar if changed
-		if user.Avatar != googleUser.Picture {
-			// TODO: Update avatar in DB
-		}
-	}
-
-	// Generate JWT
-	jwtToken, err := middleware.GenerateToken(user.ID, user.Email)
-	if err != nil {
-		return c.Redirect(config.AppConfig.FrontendURL + "/login?error=token_failed")
-	}
-
-	// Set cookie
-	middleware.SetAuthCookie(c, jwtToken, true)
-
-	// Redirect to frontend
-	return c.Redirect(config.AppConfig.FrontendURL + "/chat")
-}
-
 // UpdateUniqueID allows user to change their unique ID once
 func UpdateUniqueID(c *fiber.Ctx) error {
 	userID := middleware.GetUserID(c)
@@ -309,18 +257,37 @@ func UpdateUniqueID(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if new ID is available
-	existing, _ := models.FindUserByUniqueID(req.UniqueID)
-	if existing != nil {
+	uniqueID := models.NormalizeUniqueID(req.UniqueID)
+	if !models.ValidUniqueID(uniqueID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unique ID must be # followed by 3-20 letters, digits or hyphens",
+		})
+	}
+
+	// The unique index makes the check and the write atomic
+	err = models.ChangeUniqueID(userID, uniqueID)
+	if err == models.ErrUniqueIDTaken {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
 			"error": "This unique ID is already taken",
 		})
 	}
+	if err == models.ErrUniqueIDAlreadyChanged {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Unique ID can only be changed once",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update unique ID",
+		})
+	}
+
+	user.UniqueID = uniqueID
+	user.UniqueIDChanged = true
+	broadcastUserUpdated(user)
 
-	// TODO: Update unique ID in database
-	// For now, return success
 	return c.JSON(fiber.Map{
 		"message":   "Unique ID updated successfully",
-		"unique_id": req.UniqueID,
+		"unique_id": uniqueID,
 	})
 }
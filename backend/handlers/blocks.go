@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BlockUserRequest represents block user payload
+type BlockUserRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// blockedUsers returns the IDs of the users a user has blocked
+func blockedUsers(userID primitive.ObjectID) []primitive.ObjectID {
+	user, _ := models.FindUserByID(userID)
+	if user == nil {
+		return nil
+	}
+	return user.Blocked
+}
+
+// GetBlockedUsers returns the users the current user has blocked
+func GetBlockedUsers(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	users, err := models.GetBlockedUsers(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch blocked users",
+		})
+	}
+
+	// No presence for blocked users
+	result := make([]models.UserPublic, 0, len(users))
+	for _, user := range users {
+		result = append(result, user.ToPublicFor(userID, false))
+	}
+
+	return c.JSON(fiber.Map{
+		"blocked": result,
+	})
+}
+
+// BlockUser blocks a user and removes them from the current user's contacts
+func BlockUser(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req BlockUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	targetID, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if targetID == userID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You cannot block yourself",
+		})
+	}
+
+	target, err := models.FindUserByID(targetID)
+	if err != nil || target == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if err := models.BlockUser(userID, targetID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to block user",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User blocked successfully",
+	})
+}
+
+// UnblockUser removes a user from the current user's blocklist
+func UnblockUser(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	targetID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if err := models.UnblockUser(userID, targetID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unblock user",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User unblocked successfully",
+	})
+}
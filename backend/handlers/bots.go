@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/media"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"github.com/vinneth/go-webchat/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateBotRequest represents create bot payload
+type CreateBotRequest struct {
+	Name   string `json:"name"`
+	Avatar string `json:"avatar"`
+}
+
+// CreateAPIKeyRequest represents create API key payload
+type CreateAPIKeyRequest struct {
+	Name            string   `json:"name"`
+	Scopes          []string `json:"scopes"`
+	ConversationIDs []string `json:"conversation_ids"`
+}
+
+// findOwnedBot loads the bot in the route if it belongs to the current user
+func findOwnedBot(c *fiber.Ctx) (*models.User, error) {
+	userID := middleware.GetUserID(c)
+
+	botID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid bot ID",
+		})
+	}
+
+	bot, err := models.FindOwnedBot(userID, botID)
+	if err != nil || bot == nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Bot not found",
+		})
+	}
+
+	return bot, nil
+}
+
+// GetBots returns the bots owned by the current user
+func GetBots(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	bots, err := models.GetOwnedBots(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch bots",
+		})
+	}
+
+	result := make([]models.UserPublic, 0, len(bots))
+	for _, bot := range bots {
+		result = append(result, bot.ToPublic(websocket.Hub.IsOnline(bot.ID)))
+	}
+
+	return c.JSON(fiber.Map{
+		"bots": result,
+	})
+}
+
+// CreateBot creates a bot owned by the current user
+func CreateBot(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req CreateBotRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Bot name is required",
+		})
+	}
+
+	if req.Avatar != "" && !validAvatarURL(req.Avatar) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Avatar must be an https URL",
+		})
+	}
+
+	bot, err := models.CreateBot(userID, req.Name, req.Avatar)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create bot",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"bot": bot.ToPublic(false),
+	})
+}
+
+// DeleteBot deletes a bot along with its API keys
+func DeleteBot(c *fiber.Ctx) error {
+	bot, err := findOwnedBot(c)
+	if bot == nil {
+		return err
+	}
+
+	if err := models.DeleteBot(bot.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete bot",
+		})
+	}
+	media.Delete(media.KindAvatar, bot.AvatarMedia)
+	websocket.Hub.DisconnectUser(bot.ID)
+
+	return c.JSON(fiber.Map{
+		"message": "Bot deleted successfully",
+	})
+}
+
+// GetBotAPIKeys lists a bot's API keys
+func GetBotAPIKeys(c *fiber.Ctx) error {
+	bot, err := findOwnedBot(c)
+	if bot == nil {
+		return err
+	}
+
+	keys, err := models.GetBotAPIKeys(bot.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch API keys",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"keys": keys,
+	})
+}
+
+// CreateBotAPIKey issues a new API key for a bot
+func CreateBotAPIKey(c *fiber.Ctx) error {
+	bot, err := findOwnedBot(c)
+	if bot == nil {
+		return err
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Key name is required",
+		})
+	}
+
+	if len(req.Scopes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "At least one scope is required",
+		})
+	}
+	for _, scope := range req.Scopes {
+		if !models.ValidScope(scope) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":        "Unknown scope: " + scope,
+				"valid_scopes": models.APIKeyScopes,
+			})
+		}
+	}
+
+	if len(req.ConversationIDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "At least one conversation is required",
+		})
+	}
+
+	// Keys can only be limited to conversations the owner belongs to
+	userID := middleware.GetUserID(c)
+	conversationIDs := make([]primitive.ObjectID, 0, len(req.ConversationIDs))
+	for _, idStr := range req.ConversationIDs {
+		convID, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid conversation ID",
+			})
+		}
+
+		isMember, err := models.IsMember(convID, userID)
+		if err != nil || !isMember {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You are not a member of conversation " + idStr,
+			})
+		}
+		conversationIDs = append(conversationIDs, convID)
+	}
+
+	key := &models.APIKey{
+		BotID:           bot.ID,
+		Name:            req.Name,
+		Scopes:          req.Scopes,
+		ConversationIDs: conversationIDs,
+	}
+
+	token, err := models.CreateAPIKey(key)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create API key",
+		})
+	}
+
+	// The plaintext key is only ever returned here
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"key":     key,
+		"api_key": token,
+	})
+}
+
+// DeleteBotAPIKey revokes one of a bot's API keys
+func DeleteBotAPIKey(c *fiber.Ctx) error {
+	bot, err := findOwnedBot(c)
+	if bot == nil {
+		return err
+	}
+
+	keyID, err := primitive.ObjectIDFromHex(c.Params("keyId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid key ID",
+		})
+	}
+
+	deleted, err := models.DeleteAPIKey(bot.ID, keyID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke API key",
+		})
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "API key not found",
+		})
+	}
+
+	websocket.Hub.DisconnectAPIKey(bot.ID, keyID)
+
+	return c.JSON(fiber.Map{
+		"message": "API key revoked successfully",
+	})
+}
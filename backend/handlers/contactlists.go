@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxContactListNameLength = 30
+
+// ContactListRequest represents create or rename contact list payload
+type ContactListRequest struct {
+	Name string `json:"name"`
+}
+
+// ContactListWithCount is a contact list with the number of contacts in it
+type ContactListWithCount struct {
+	models.ContactList
+	ContactCount int `json:"contact_count"`
+}
+
+// parseContactListName validates a contact list name against the user's other lists
+func parseContactListName(c *fiber.Ctx, user *models.User, exclude primitive.ObjectID) (string, error) {
+	var req ContactListRequest
+	if err := c.BodyParser(&req); err != nil {
+		return "", c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxContactListNameLength {
+		return "", c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("List name must be between 1 and %d characters", maxContactListNameLength),
+		})
+	}
+
+	for _, list := range user.ContactLists {
+		if list.ID != exclude && strings.EqualFold(list.Name, name) {
+			return "", c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "You already have a list with this name",
+			})
+		}
+	}
+
+	return name, nil
+}
+
+// GetContactLists returns the user's contact lists
+func GetContactLists(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	counts := make(map[primitive.ObjectID]int)
+	for _, entry := range user.Contacts {
+		for _, listID := range entry.Lists {
+			counts[listID]++
+		}
+	}
+
+	result := make([]ContactListWithCount, 0, len(user.ContactLists))
+	for _, list := range user.ContactLists {
+		result = append(result, ContactListWithCount{ContactList: list, ContactCount: counts[list.ID]})
+	}
+
+	return c.JSON(fiber.Map{
+		"lists": result,
+	})
+}
+
+// CreateContactList adds a contact list for the user
+func CreateContactList(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	name, err := parseContactListName(c, user, primitive.NilObjectID)
+	if name == "" {
+		return err
+	}
+
+	list, err := models.CreateContactList(userID, name)
+	if errors.Is(err, models.ErrTooManyContactLists) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("You can have at most %d contact lists", models.MaxContactLists),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create list",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"list": ContactListWithCount{ContactList: *list},
+	})
+}
+
+// RenameContactList renames one of the user's contact lists
+func RenameContactList(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	listID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid list ID",
+		})
+	}
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	name, err := parseContactListName(c, user, listID)
+	if name == "" {
+		return err
+	}
+
+	found, err := models.RenameContactList(userID, listID, name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to rename list",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "List not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "List renamed successfully",
+	})
+}
+
+// DeleteContactList deletes one of the user's contact lists; the contacts in it are kept
+func DeleteContactList(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	listID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid list ID",
+		})
+	}
+
+	found, err := models.DeleteContactList(userID, listID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete list",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "List not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "List deleted successfully",
+	})
+}
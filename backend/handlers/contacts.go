@@ -1,6 +1,13 @@
 package handlers
 
 import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/vinneth/go-webchat/middleware"
 	"github.com/vinneth/go-webchat/models"
@@ -8,13 +15,123 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	maxContactNoteLength = 500
+
+	// Searches need this many letters or digits, so a bare "#" or "a" can't list everyone
+	minDiscoverQueryLength = 2
+	// Discovery finds people by name or ID; it isn't for paging through every user
+	maxDiscoverSkip = 200
+)
+
 // AddContactRequest represents add contact payload
 type AddContactRequest struct {
 	UniqueID string `json:"unique_id"`
 }
 
-// AddContact adds a contact by unique ID
-func AddContact(c *fiber.Ctx) error {
+// UpdateContactRequest represents update contact payload; omitted fields are left unchanged
+type UpdateContactRequest struct {
+	Nickname *string  `json:"nickname"`
+	Note     *string  `json:"note"`
+	Favorite *bool    `json:"favorite"`
+	Lists    []string `json:"lists"` // Replaces the contact's lists when present
+}
+
+// ContactDetails is a contact's public profile together with the user's private annotations
+type ContactDetails struct {
+	models.UserPublic
+	Note     string               `json:"note,omitempty"`
+	Favorite bool                 `json:"favorite"`
+	Lists    []primitive.ObjectID `json:"lists"`
+	AddedAt  time.Time            `json:"added_at"`
+}
+
+// displayName is the nickname where set, otherwise the contact's own name
+func (d ContactDetails) displayName() string {
+	if d.Nickname != "" {
+		return d.Nickname
+	}
+	return d.Name
+}
+
+// contactDetails combines a contact with the viewer's annotations,
+// reporting false if they are not one of the viewer's contacts
+func contactDetails(viewer, contact *models.User) (ContactDetails, bool) {
+	entry := viewer.FindContact(contact.ID)
+	if entry == nil {
+		return ContactDetails{}, false
+	}
+
+	details := ContactDetails{
+		UserPublic: contact.ToPublicFor(viewer.ID, websocket.Hub.IsOnline(contact.ID)),
+		Note:       entry.Note,
+		Favorite:   entry.Favorite,
+		Lists:      entry.Lists,
+		AddedAt:    entry.AddedAt,
+	}
+	details.Nickname = entry.Nickname
+	if details.Lists == nil {
+		details.Lists = []primitive.ObjectID{}
+	}
+	return details, true
+}
+
+// withNickname adds the nickname the viewer gave a user, if any
+func withNickname(viewer *models.User, public models.UserPublic) models.UserPublic {
+	if viewer != nil {
+		if entry := viewer.FindContact(public.ID); entry != nil {
+			public.Nickname = entry.Nickname
+		}
+	}
+	return public
+}
+
+func containsObjectID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// contactRequestWithUser attaches the other party's public info to a request, as seen by viewerID
+func contactRequestWithUser(req models.ContactRequest, otherID, viewerID primitive.ObjectID) models.ContactRequestWithUser {
+	result := models.ContactRequestWithUser{ContactRequest: req}
+	other, _ := models.FindUserByID(otherID)
+	if other != nil {
+		public := other.ToPublicFor(viewerID, websocket.Hub.IsOnline(other.ID))
+		result.User = &public
+	}
+	return result
+}
+
+// acceptContactRequest makes both users mutual contacts and notifies the requester
+func acceptContactRequest(req *models.ContactRequest) error {
+	if err := models.AddContact(req.ToID, req.FromID); err != nil {
+		return err
+	}
+	if err := models.AddContact(req.FromID, req.ToID); err != nil {
+		return err
+	}
+
+	models.DeleteContactRequest(req.ID)
+
+	accepter, _ := models.FindUserByID(req.ToID)
+	if accepter != nil {
+		websocket.Hub.SendToUser(req.FromID, websocket.WSMessage{
+			Type: "contact:accepted",
+			Payload: map[string]interface{}{
+				"request_id": req.ID,
+				"contact":    accepter.ToPublicFor(req.FromID, websocket.Hub.IsOnline(accepter.ID)),
+			},
+		})
+	}
+	return nil
+}
+
+// SendContactRequest asks a user, found by unique ID, to become a contact
+func SendContactRequest(c *fiber.Ctx) error {
 	userID := middleware.GetUserID(c)
 
 	var req AddContactRequest
@@ -38,6 +155,12 @@ func AddContact(c *fiber.Ctx) error {
 		})
 	}
 
+	return requestContact(c, userID, contact, nil)
+}
+
+// requestContact sends contact a request from userID, or accepts theirs if they already sent one.
+// Requests made through an invite link skip the discoverability check and count as a use of the invite.
+func requestContact(c *fiber.Ctx, userID primitive.ObjectID, contact *models.User, invite *models.ContactInvite) error {
 	// Cannot add self
 	if contact.ID == userID {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -45,41 +168,287 @@ func AddContact(c *fiber.Ctx) error {
 		})
 	}
 
+	if contact.IsBot {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Bots cannot be added as contacts",
+		})
+	}
+
+	// Neither side can reach the other once blocked
+	if contact.HasBlocked(userID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You can't send a contact request to this user",
+		})
+	}
+
 	// Check if already a contact
 	user, _ := models.FindUserByID(userID)
-	if user != nil {
-		for _, cID := range user.Contacts {
-			if cID == contact.ID {
-				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-					"error": "Already in your contacts",
+	if user != nil && user.HasBlocked(contact.ID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unblock this user first",
+		})
+	}
+	if user != nil && user.HasContact(contact.ID) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Already in your contacts",
+		})
+	}
+
+	// If they already asked us, this is an accept
+	incoming, err := models.FindContactRequest(contact.ID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send contact request",
+		})
+	}
+	if incoming != nil {
+		if err := acceptContactRequest(incoming); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to add contact",
+			})
+		}
+
+		// Answering their request doesn't need the link, so a use that fails here changes nothing
+		if invite != nil {
+			models.UseContactInvite(invite.ID)
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"message": "Contact added successfully",
+			"contact": contact.ToPublicFor(userID, websocket.Hub.IsOnline(contact.ID)),
+		})
+	}
+
+	// Users who can't discover them may only answer their requests
+	if user == nil || (invite == nil && !contact.DiscoverableBy(user)) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User with this ID not found",
+		})
+	}
+
+	request, err := models.CreateContactRequest(userID, contact.ID)
+	if err == models.ErrContactRequestExists {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Contact request already sent",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send contact request",
+		})
+	}
+
+	// The link is only used up once the request exists
+	if invite != nil {
+		ok, err := models.UseContactInvite(invite.ID)
+		if err != nil || !ok {
+			models.DeleteContactRequest(request.ID)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to send contact request",
 				})
 			}
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{
+				"error": "This invite link has expired",
+			})
 		}
 	}
 
-	// Add contact (both ways for mutual contact)
-	if err := models.AddContact(userID, contact.ID); err != nil {
+	// Notify the recipient
+	websocket.Hub.SendToUser(contact.ID, websocket.WSMessage{
+		Type: "contact:request",
+		Payload: map[string]interface{}{
+			"request": contactRequestWithUser(*request, userID, contact.ID),
+		},
+	})
+
+	// Presence is only shared once the request is accepted
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Contact request sent",
+		"request": contactRequestWithUser(*request, contact.ID, userID),
+	})
+}
+
+// GetContactRequests returns the user's incoming and outgoing contact requests
+func GetContactRequests(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	incoming, err := models.GetIncomingContactRequests(userID)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to add contact",
+			"error": "Failed to fetch contact requests",
 		})
 	}
 
-	// Add reverse contact
-	models.AddContact(contact.ID, userID)
+	outgoing, err := models.GetOutgoingContactRequests(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch contact requests",
+		})
+	}
 
-	// Check if online
-	isOnline := websocket.Hub.IsOnline(contact.ID)
+	incomingResult := make([]models.ContactRequestWithUser, 0, len(incoming))
+	for _, req := range incoming {
+		incomingResult = append(incomingResult, contactRequestWithUser(req, req.FromID, userID))
+	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+	outgoingResult := make([]models.ContactRequestWithUser, 0, len(outgoing))
+	for _, req := range outgoing {
+		outgoingResult = append(outgoingResult, contactRequestWithUser(req, req.ToID, userID))
+	}
+
+	return c.JSON(fiber.Map{
+		"incoming": incomingResult,
+		"outgoing": outgoingResult,
+	})
+}
+
+// findContactRequest loads the request named in the route
+func findContactRequest(c *fiber.Ctx) (*models.ContactRequest, error) {
+	reqID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request ID",
+		})
+	}
+
+	request, err := models.FindContactRequestByID(reqID)
+	if err != nil || request == nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contact request not found",
+		})
+	}
+
+	return request, nil
+}
+
+// AcceptContactRequest accepts an incoming contact request
+func AcceptContactRequest(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	request, err := findContactRequest(c)
+	if request == nil {
+		return err
+	}
+
+	if request.ToID != userID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contact request not found",
+		})
+	}
+
+	if err := acceptContactRequest(request); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to accept contact request",
+		})
+	}
+
+	var contact *models.UserPublic
+	requester, _ := models.FindUserByID(request.FromID)
+	if requester != nil {
+		public := requester.ToPublicFor(userID, websocket.Hub.IsOnline(requester.ID))
+		contact = &public
+	}
+
+	return c.JSON(fiber.Map{
 		"message": "Contact added successfully",
-		"contact": contact.ToPublic(isOnline),
+		"contact": contact,
+	})
+}
+
+// DeclineContactRequest declines an incoming contact request without notifying the sender
+func DeclineContactRequest(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	request, err := findContactRequest(c)
+	if request == nil {
+		return err
+	}
+
+	if request.ToID != userID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contact request not found",
+		})
+	}
+
+	if _, err := models.DeleteContactRequest(request.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decline contact request",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Contact request declined",
 	})
 }
 
-// GetContacts returns user's contact list
+// CancelContactRequest withdraws an outgoing contact request
+func CancelContactRequest(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	request, err := findContactRequest(c)
+	if request == nil {
+		return err
+	}
+
+	if request.FromID != userID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contact request not found",
+		})
+	}
+
+	if _, err := models.DeleteContactRequest(request.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to cancel contact request",
+		})
+	}
+
+	// Let the recipient drop it from their list
+	websocket.Hub.SendToUser(request.ToID, websocket.WSMessage{
+		Type: "contact:request_cancelled",
+		Payload: map[string]interface{}{
+			"request_id": request.ID,
+		},
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Contact request cancelled",
+	})
+}
+
+// GetContacts returns user's contact list with their annotations.
+// Filters: favorite=true, list=<list ID> and q (matches name or nickname).
+// Sort: name (default, by nickname where set), added (newest first) or favorite (favorites first, then name).
 func GetContacts(c *fiber.Ctx) error {
 	userID := middleware.GetUserID(c)
 
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	var listID primitive.ObjectID
+	if list := c.Query("list"); list != "" {
+		listID, err = primitive.ObjectIDFromHex(list)
+		if err != nil || user.FindContactList(listID) == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid list ID",
+			})
+		}
+	}
+
+	sortBy := c.Query("sort", "name")
+	if sortBy != "name" && sortBy != "added" && sortBy != "favorite" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Sort must be name, added or favorite",
+		})
+	}
+
+	favoritesOnly := c.QueryBool("favorite")
+	query := strings.ToLower(strings.TrimSpace(c.Query("q")))
+
 	contacts, err := models.GetContacts(userID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -88,14 +457,134 @@ func GetContacts(c *fiber.Ctx) error {
 	}
 
 	// Convert to public with online status
-	publicContacts := make([]models.UserPublic, len(contacts))
-	for i, contact := range contacts {
-		isOnline := websocket.Hub.IsOnline(contact.ID)
-		publicContacts[i] = contact.ToPublic(isOnline)
+	result := make([]ContactDetails, 0, len(contacts))
+	for i := range contacts {
+		details, ok := contactDetails(user, &contacts[i])
+		if !ok {
+			continue
+		}
+		if favoritesOnly && !details.Favorite {
+			continue
+		}
+		if !listID.IsZero() && !containsObjectID(details.Lists, listID) {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(details.Name), query) &&
+			!strings.Contains(strings.ToLower(details.Nickname), query) {
+			continue
+		}
+		result = append(result, details)
 	}
 
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		switch sortBy {
+		case "added":
+			return a.AddedAt.After(b.AddedAt)
+		case "favorite":
+			if a.Favorite != b.Favorite {
+				return a.Favorite
+			}
+		}
+		return strings.ToLower(a.displayName()) < strings.ToLower(b.displayName())
+	})
+
 	return c.JSON(fiber.Map{
-		"contacts": publicContacts,
+		"contacts": result,
+	})
+}
+
+// UpdateContact changes the user's nickname, note, favorite flag and lists for a contact
+func UpdateContact(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	contactID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid contact ID",
+		})
+	}
+
+	var req UpdateContactRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if !user.HasContact(contactID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contact not found",
+		})
+	}
+
+	update := models.ContactEntryUpdate{Favorite: req.Favorite}
+
+	if req.Nickname != nil {
+		nickname := strings.TrimSpace(*req.Nickname)
+		if utf8.RuneCountInString(nickname) > maxNameLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Nickname is too long",
+			})
+		}
+		update.Nickname = &nickname
+	}
+
+	if req.Note != nil {
+		note := strings.TrimSpace(*req.Note)
+		if utf8.RuneCountInString(note) > maxContactNoteLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Note is too long",
+			})
+		}
+		update.Note = &note
+	}
+
+	if req.Lists != nil {
+		update.Lists = make([]primitive.ObjectID, 0, len(req.Lists))
+		for _, idStr := range req.Lists {
+			listID, err := primitive.ObjectIDFromHex(idStr)
+			if err != nil || user.FindContactList(listID) == nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Unknown contact list",
+				})
+			}
+			if !containsObjectID(update.Lists, listID) {
+				update.Lists = append(update.Lists, listID)
+			}
+		}
+	}
+
+	found, err := models.UpdateContactEntry(userID, contactID, update)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update contact",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contact not found",
+		})
+	}
+
+	user, _ = models.FindUserByID(userID)
+	contact, _ := models.FindUserByID(contactID)
+	if user == nil || contact == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Contact not found",
+		})
+	}
+	details, _ := contactDetails(user, contact)
+
+	return c.JSON(fiber.Map{
+		"message": "Contact updated successfully",
+		"contact": details,
 	})
 }
 
@@ -127,6 +616,7 @@ func RemoveContact(c *fiber.Ctx) error {
 
 // SearchUserByUniqueID searches for a user by unique ID
 func SearchUserByUniqueID(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
 	uniqueID := c.Query("unique_id")
 	if uniqueID == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -141,9 +631,100 @@ func SearchUserByUniqueID(c *fiber.Ctx) error {
 		})
 	}
 
+	viewer, _ := models.FindUserByID(userID)
+	if viewer == nil || !user.DiscoverableBy(viewer) || user.HasBlocked(userID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
 	isOnline := websocket.Hub.IsOnline(user.ID)
 
 	return c.JSON(fiber.Map{
-		"user": user.ToPublic(isOnline),
+		"user": user.ToPublicFor(userID, isOnline),
+	})
+}
+
+// DiscoveredUser is a user search result
+type DiscoveredUser struct {
+	models.UserPublic
+	MutualContacts int  `json:"mutual_contacts"`
+	SharedGroup    bool `json:"shared_group"`
+}
+
+// significantRunes counts the letters and digits in a search query, ignoring "#" and spaces
+func significantRunes(query string) int {
+	count := 0
+	for _, r := range query {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			count++
+		}
+	}
+	return count
+}
+
+// DiscoverUsers searches users by name or unique ID prefix, closest connections first
+func DiscoverUsers(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Search query is required",
+		})
+	}
+	if utf8.RuneCountInString(query) > maxNameLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Search query is too long",
+		})
+	}
+	if significantRunes(query) < minDiscoverQueryLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Search query is too short",
+		})
+	}
+
+	// Pagination
+	limit, _ := strconv.ParseInt(c.Query("limit", "20"), 10, 64)
+	skip, _ := strconv.ParseInt(c.Query("skip", "0"), 10, 64)
+
+	if limit <= 0 || limit > 50 {
+		limit = 50
+	}
+	if skip < 0 {
+		skip = 0
+	}
+	if skip > maxDiscoverSkip {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Too many results, please refine your search",
+		})
+	}
+
+	viewer, err := models.FindUserByID(userID)
+	if err != nil || viewer == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	users, total, err := models.DiscoverUsers(viewer, query, skip, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to search users",
+		})
+	}
+
+	result := make([]DiscoveredUser, 0, len(users))
+	for _, user := range users {
+		result = append(result, DiscoveredUser{
+			UserPublic:     user.ToPublicFor(userID, websocket.Hub.IsOnline(user.ID)),
+			MutualContacts: user.MutualContacts,
+			SharedGroup:    user.SharedGroup,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"users": result,
+		"total": total,
 	})
 }
@@ -12,7 +12,13 @@ import (
 
 // CreateConversationRequest represents create conversation payload
 type CreateConversationRequest struct {
-	UserID string `json:"user_id"` // For private chat
+	UserID    string `json:"user_id"`   // For private chat
+	Encrypted bool   `json:"encrypted"` // Start an end-to-end encrypted chat
+}
+
+// SendMessageRequest represents send message payload
+type SendMessageRequest struct {
+	Content string `json:"content"`
 }
 
 // GetConversations returns user's conversations
@@ -26,19 +32,36 @@ func GetConversations(c *fiber.Ctx) error {
 		})
 	}
 
+	// Messages from blocked users are hidden
+	hidden := blockedUsers(userID)
+
+	// Contacts are shown with the nicknames the user gave them
+	viewer, _ := models.FindUserByID(userID)
+
 	// Enrich with details
 	result := make([]models.ConversationWithDetails, 0, len(conversations))
 	for _, conv := range conversations {
+		if !middleware.CanAccessConversation(c, conv.ID) {
+			continue
+		}
+
 		details := models.ConversationWithDetails{
 			Conversation: conv,
 		}
 
 		// Get last message
-		lastMsg, _ := models.GetLastMessage(conv.ID)
+		lastMsg, _ := models.GetLastMessage(conv.ID, hidden)
+		if lastMsg != nil && lastMsg.IsEncrypted() {
+			// No previews for end-to-end encrypted messages
+			lastMsg.Ciphertext = ""
+		}
+		if lastMsg != nil {
+			lastMsg.HideReaders(hiddenReaders(&conv), userID)
+		}
 		details.LastMessage = lastMsg
 
 		// Get unread count
-		unreadCount, _ := models.GetUnreadCount(conv.ID, userID)
+		unreadCount, _ := models.GetUnreadCount(conv.ID, userID, hidden)
 		details.UnreadCount = int(unreadCount)
 
 		if conv.Type == models.ConversationTypePrivate {
@@ -48,7 +71,7 @@ func GetConversations(c *fiber.Ctx) error {
 					otherUser, _ := models.FindUserByID(memberID)
 					if otherUser != nil {
 						isOnline := websocket.Hub.IsOnline(otherUser.ID)
-						public := otherUser.ToPublic(isOnline)
+						public := withNickname(viewer, otherUser.ToPublicFor(userID, isOnline))
 						details.OtherUser = &public
 					}
 					break
@@ -61,7 +84,7 @@ func GetConversations(c *fiber.Ctx) error {
 				member, _ := models.FindUserByID(memberID)
 				if member != nil {
 					isOnline := websocket.Hub.IsOnline(member.ID)
-					membersList = append(membersList, member.ToPublic(isOnline))
+					membersList = append(membersList, withNickname(viewer, member.ToPublicFor(userID, isOnline)))
 				}
 			}
 			details.MembersList = membersList
@@ -108,8 +131,43 @@ func CreateConversation(c *fiber.Ctx) error {
 		})
 	}
 
+	if otherUser.IsBot {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Bots can only be added to groups",
+		})
+	}
+
+	blocked, err := models.IsBlockedBetween(userID, otherUserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create conversation",
+		})
+	}
+	if blocked {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You can't message this user",
+		})
+	}
+
+	// Both sides need published keys to encrypt to each other
+	if req.Encrypted {
+		for _, memberID := range []primitive.ObjectID{userID, otherUserID} {
+			devices, err := models.CountUserDevices(memberID)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to create conversation",
+				})
+			}
+			if devices == 0 {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Both users need a registered device to start an encrypted chat",
+				})
+			}
+		}
+	}
+
 	// Get or create conversation
-	conv, err := models.GetOrCreatePrivateConversation(userID, otherUserID)
+	conv, err := models.GetOrCreatePrivateConversation(userID, otherUserID, req.Encrypted)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create conversation",
@@ -118,9 +176,11 @@ func CreateConversation(c *fiber.Ctx) error {
 
 	// Return with details
 	isOnline := websocket.Hub.IsOnline(otherUser.ID)
+	viewer, _ := models.FindUserByID(userID)
+	otherPublic := withNickname(viewer, otherUser.ToPublicFor(userID, isOnline))
 	result := models.ConversationWithDetails{
 		Conversation: *conv,
-		OtherUser:    &models.UserPublic{ID: otherUser.ID, UniqueID: otherUser.UniqueID, Name: otherUser.Name, Avatar: otherUser.Avatar, IsOnline: isOnline},
+		OtherUser:    &otherPublic,
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
@@ -142,7 +202,7 @@ func GetConversation(c *fiber.Ctx) error {
 
 	// Check if user is member
 	isMember, err := models.IsMember(convID, userID)
-	if err != nil || !isMember {
+	if err != nil || !isMember || !middleware.CanAccessConversation(c, convID) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"error": "Access denied",
 		})
@@ -159,6 +219,7 @@ func GetConversation(c *fiber.Ctx) error {
 	details := models.ConversationWithDetails{
 		Conversation: *conv,
 	}
+	viewer, _ := models.FindUserByID(userID)
 
 	if conv.Type == models.ConversationTypePrivate {
 		for _, memberID := range conv.Members {
@@ -166,7 +227,7 @@ func GetConversation(c *fiber.Ctx) error {
 				otherUser, _ := models.FindUserByID(memberID)
 				if otherUser != nil {
 					isOnline := websocket.Hub.IsOnline(otherUser.ID)
-					public := otherUser.ToPublic(isOnline)
+					public := withNickname(viewer, otherUser.ToPublicFor(userID, isOnline))
 					details.OtherUser = &public
 				}
 				break
@@ -178,7 +239,7 @@ func GetConversation(c *fiber.Ctx) error {
 			member, _ := models.FindUserByID(memberID)
 			if member != nil {
 				isOnline := websocket.Hub.IsOnline(member.ID)
-				membersList = append(membersList, member.ToPublic(isOnline))
+				membersList = append(membersList, withNickname(viewer, member.ToPublicFor(userID, isOnline)))
 			}
 		}
 		details.MembersList = membersList
@@ -203,7 +264,7 @@ func GetMessages(c *fiber.Ctx) error {
 
 	// Check if user is member
 	isMember, err := models.IsMember(convID, userID)
-	if err != nil || !isMember {
+	if err != nil || !isMember || !middleware.CanAccessConversation(c, convID) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"error": "Access denied",
 		})
@@ -217,7 +278,7 @@ func GetMessages(c *fiber.Ctx) error {
 		limit = 100
 	}
 
-	messages, err := models.GetMessages(convID, limit, skip)
+	messages, err := models.GetMessages(convID, limit, skip, blockedUsers(userID))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch messages",
@@ -227,16 +288,23 @@ func GetMessages(c *fiber.Ctx) error {
 	// Mark as read
 	models.MarkConversationAsRead(convID, userID)
 
+	// Reads by members who turned read receipts off stay private
+	var readersHidden []primitive.ObjectID
+	if conv, _ := models.FindConversationByID(convID); conv != nil {
+		readersHidden = hiddenReaders(conv)
+	}
+
 	// Enrich with sender info
 	result := make([]models.MessageWithSender, len(messages))
 	for i, msg := range messages {
+		msg.HideReaders(readersHidden, userID)
 		result[i] = models.MessageWithSender{
 			Message: msg,
 		}
 		sender, _ := models.FindUserByID(msg.SenderID)
 		if sender != nil {
 			isOnline := websocket.Hub.IsOnline(sender.ID)
-			public := sender.ToPublic(isOnline)
+			public := sender.ToPublicFor(userID, isOnline)
 			result[i].Sender = &public
 		}
 	}
@@ -245,3 +313,62 @@ func GetMessages(c *fiber.Ctx) error {
 		"messages": result,
 	})
 }
+
+// SendMessage posts a message to a conversation, e.g. from a bot
+func SendMessage(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	convIDStr := c.Params("id")
+
+	convID, err := primitive.ObjectIDFromHex(convIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid conversation ID",
+		})
+	}
+
+	var req SendMessageRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Content == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Message content is required",
+		})
+	}
+
+	// Check if user is member
+	isMember, err := models.IsMember(convID, userID)
+	if err != nil || !isMember || !middleware.CanAccessConversation(c, convID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Access denied",
+		})
+	}
+
+	msg, err := websocket.DeliverMessage(&models.Message{
+		ConversationID: convID,
+		SenderID:       userID,
+		Content:        req.Content,
+	})
+	if err == models.ErrPlaintextInEncrypted {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Conversation is end-to-end encrypted",
+		})
+	}
+	if err == models.ErrBlocked {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You can't message this user",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send message",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": msg,
+	})
+}
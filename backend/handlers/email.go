@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/config"
+	"github.com/vinneth/go-webchat/mailer"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"github.com/vinneth/go-webchat/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	verifyEmailTokenTTL   = 24 * time.Hour
+	passwordResetTokenTTL = time.Hour
+
+	// Password reset requests allowed per hour, so the endpoint can't be used to flood inboxes
+	passwordResetsPerEmail = 3
+	passwordResetsPerIP    = 20
+)
+
+// TokenRequest represents a payload carrying an emailed token
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+// ForgotPasswordRequest represents forgot password payload
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest represents reset password payload
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// sendVerificationEmail emails the user a link to verify their address
+func sendVerificationEmail(user *models.User) error {
+	token, err := middleware.GenerateActionToken(user.ID, middleware.PurposeVerifyEmail,
+		middleware.TokenBinding(user.Email), verifyEmailTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := config.AppConfig.APIURL + "/api/auth/verify-email?token=" + url.QueryEscape(token)
+	mailer.SendAsync(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in 24 hours. If you didn't create an account, you can ignore this email.\n",
+			user.Name, link),
+	})
+	return nil
+}
+
+// sendPasswordResetEmail emails the user a link to choose a new password
+func sendPasswordResetEmail(user *models.User) error {
+	token, err := middleware.GenerateActionToken(user.ID, middleware.PurposePasswordReset,
+		middleware.TokenBinding(user.PasswordHash), passwordResetTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := config.AppConfig.FrontendURL + "/reset-password?token=" + url.QueryEscape(token)
+	mailer.SendAsync(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. "+
+			"To choose a new password, open the link below:\n\n%s\n\n"+
+			"The link expires in 1 hour. If you didn't ask for this, you can ignore this email.\n",
+			user.Name, link),
+	})
+	return nil
+}
+
+// verifyEmailToken marks the email in a verification token as verified
+func verifyEmailToken(token string) error {
+	claims, err := middleware.ValidateActionToken(token, middleware.PurposeVerifyEmail)
+	if err != nil {
+		return err
+	}
+
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return err
+	}
+
+	user, err := models.FindUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil || middleware.TokenBinding(user.Email) != claims.Binding {
+		return fiber.ErrBadRequest
+	}
+
+	_, err = models.MarkEmailVerified(user.ID, user.Email)
+	return err
+}
+
+// RequestEmailVerification sends a new verification email
+func RequestEmailVerification(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if user.EmailVerified {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Email is already verified",
+		})
+	}
+
+	if err := sendVerificationEmail(user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send verification email",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Verification email sent",
+	})
+}
+
+// VerifyEmail verifies an email address from a JSON payload
+func VerifyEmail(c *fiber.Ctx) error {
+	var req TokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := verifyEmailToken(req.Token); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired verification link",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Email verified successfully",
+	})
+}
+
+// VerifyEmailLink verifies an email address from the emailed link and redirects to the frontend
+func VerifyEmailLink(c *fiber.Ctx) error {
+	if err := verifyEmailToken(c.Query("token")); err != nil {
+		return c.Redirect(config.AppConfig.FrontendURL + "/login?error=verification_failed")
+	}
+	return c.Redirect(config.AppConfig.FrontendURL + "/chat?verified=1")
+}
+
+// passwordResetPolicy limits password reset requests to maxAttempts an hour
+func passwordResetPolicy(maxAttempts int) models.ThrottlePolicy {
+	return models.ThrottlePolicy{
+		MaxAttempts: maxAttempts,
+		Window:      time.Hour,
+		Lockout:     time.Hour,
+		MaxLockout:  time.Hour,
+	}
+}
+
+// ForgotPassword sends a password reset email if the account exists
+func ForgotPassword(c *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Email is required",
+		})
+	}
+
+	ipKey := "reset:" + ipThrottleKey(c)
+	if retryAfter, _, err := models.RecordThrottleHit(ipKey, passwordResetPolicy(passwordResetsPerIP)); err == nil && retryAfter > 0 {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":       "Too many password reset requests. Please try again later.",
+			"retry_after": seconds,
+		})
+	}
+
+	// Always answer the same way, whether or not the account exists or the address was
+	// throttled, so the endpoint can't be used to probe for accounts. The email is sent
+	// in the background.
+	emailKey := "reset:" + accountThrottleKey(req.Email)
+	retryAfter, _, err := models.RecordThrottleHit(emailKey, passwordResetPolicy(passwordResetsPerEmail))
+	if err == nil && retryAfter == 0 {
+		user, _ := models.FindUserByEmail(req.Email)
+		if user != nil {
+			if err := sendPasswordResetEmail(user); err != nil {
+				log.Printf("Failed to send password reset email: %v", err)
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "If an account exists for this email, a password reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password using a reset token
+func ResetPassword(c *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if len(req.Password) < 6 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Password must be at least 6 characters",
+		})
+	}
+
+	claims, err := middleware.ValidateActionToken(req.Token, middleware.PurposePasswordReset)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired reset link",
+		})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired reset link",
+		})
+	}
+
+	// The binding changes with the password, so each link works only once
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil || middleware.TokenBinding(user.PasswordHash) != claims.Binding {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired reset link",
+		})
+	}
+
+	hashedPassword, err := models.HashPassword(req.Password)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to process password",
+		})
+	}
+
+	if err := models.UpdatePassword(user.ID, hashedPassword); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to reset password",
+		})
+	}
+
+	// Following the emailed link proves ownership of the address
+	models.MarkEmailVerified(user.ID, user.Email)
+
+	// Sign out everywhere in case the old password was compromised
+	models.RevokeAllSessions(user.ID)
+	websocket.Hub.DisconnectUser(user.ID)
+
+	return c.JSON(fiber.Map{
+		"message": "Password reset successfully, please sign in",
+	})
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/config"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateGroupInviteRequest represents create group invite payload
+type CreateGroupInviteRequest struct {
+	MaxUses          int  `json:"max_uses"`   // Zero for unlimited
+	ExpiresIn        int  `json:"expires_in"` // Seconds; zero for no expiry
+	ApprovalRequired bool `json:"approval_required"`
+}
+
+// GroupInviteWithLink is a group invite together with the link to share
+type GroupInviteWithLink struct {
+	models.GroupInvite
+	Link string `json:"link"`
+}
+
+// GroupPreview is what anyone holding an invite link can see of a group
+type GroupPreview struct {
+	ID          primitive.ObjectID `json:"id"`
+	Name        string             `json:"name"`
+	Icon        string             `json:"icon,omitempty"`
+	MemberCount int                `json:"member_count"`
+}
+
+// groupInviteLink returns the frontend link that redeems a group invite token
+func groupInviteLink(token string) string {
+	return config.AppConfig.FrontendURL + "/join/" + token
+}
+
+// findInvitingGroup loads the group named in the route, if the current user may manage its invite links
+func findInvitingGroup(c *fiber.Ctx) (*models.Conversation, error) {
+	return findPermittedGroup(c, models.PermAddMembers, "You don't have permission to manage invite links")
+}
+
+// findUsableGroupInvite loads the invite for the token in the route along with its group
+func findUsableGroupInvite(c *fiber.Ctx) (*models.GroupInvite, *models.Conversation, error) {
+	invite, err := models.FindUsableGroupInvite(c.Params("token"))
+	if err != nil {
+		return nil, nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to look up invite",
+		})
+	}
+	if invite == nil {
+		return nil, nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "This invite link is invalid or has expired",
+		})
+	}
+
+	group, err := models.FindConversationByID(invite.GroupID)
+	if err != nil || group == nil || group.Type != models.ConversationTypeGroup {
+		return nil, nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "This invite link is invalid or has expired",
+		})
+	}
+
+	return invite, group, nil
+}
+
+// CreateGroupInvite creates a shareable invite link for a group
+func CreateGroupInvite(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	group, err := findInvitingGroup(c)
+	if group == nil {
+		return err
+	}
+
+	var req CreateGroupInviteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.MaxUses < 0 || req.MaxUses > maxInviteUses {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Max uses must be between 0 and %d", maxInviteUses),
+		})
+	}
+
+	if req.ExpiresIn < 0 || req.ExpiresIn > int(maxInviteLifetime/time.Second) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invites can expire after at most a year",
+		})
+	}
+	lifetime := time.Duration(req.ExpiresIn) * time.Second
+
+	count, err := models.CountGroupInvites(group.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create invite",
+		})
+	}
+	if count >= models.MaxGroupInvitesPerGroup {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "This group has too many invite links; revoke one first",
+		})
+	}
+
+	var expiresAt *time.Time
+	if lifetime > 0 {
+		t := time.Now().Add(lifetime)
+		expiresAt = &t
+	}
+
+	invite, err := models.CreateGroupInvite(group.ID, userID, req.MaxUses, req.ApprovalRequired, expiresAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create invite",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"invite": GroupInviteWithLink{GroupInvite: *invite, Link: groupInviteLink(invite.Token)},
+	})
+}
+
+// GetGroupInvites lists a group's invite links
+func GetGroupInvites(c *fiber.Ctx) error {
+	group, err := findInvitingGroup(c)
+	if group == nil {
+		return err
+	}
+
+	invites, err := models.GetGroupInvites(group.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch invites",
+		})
+	}
+
+	result := make([]GroupInviteWithLink, 0, len(invites))
+	for _, invite := range invites {
+		result = append(result, GroupInviteWithLink{GroupInvite: invite, Link: groupInviteLink(invite.Token)})
+	}
+
+	return c.JSON(fiber.Map{
+		"invites": result,
+	})
+}
+
+// RevokeGroupInvite deletes one of a group's invite links
+func RevokeGroupInvite(c *fiber.Ctx) error {
+	group, err := findInvitingGroup(c)
+	if group == nil {
+		return err
+	}
+
+	inviteID, err := primitive.ObjectIDFromHex(c.Params("inviteId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid invite ID",
+		})
+	}
+
+	found, err := models.DeleteGroupInvite(inviteID, group.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke invite",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invite not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Invite revoked successfully",
+	})
+}
+
+// GetGroupInvitePreview shows what group an invite link is for; it doesn't require signing in
+func GetGroupInvitePreview(c *fiber.Ctx) error {
+	invite, group, err := findUsableGroupInvite(c)
+	if invite == nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"group": GroupPreview{
+			ID:          group.ID,
+			Name:        group.GroupName,
+			Icon:        group.GroupIcon,
+			MemberCount: len(group.Members),
+		},
+		"approval_required": invite.ApprovalRequired,
+		"expires_at":        invite.ExpiresAt,
+	})
+}
+
+// JoinGroupByInvite adds the current user to the group of an invite link, or
+// submits a request to join when the link requires approval
+func JoinGroupByInvite(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	invite, group, err := findUsableGroupInvite(c)
+	if invite == nil {
+		return err
+	}
+
+	if group.HasMember(userID) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "You are already a member of this group",
+		})
+	}
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if invite.ApprovalRequired {
+		return requestToJoinGroup(c, group, invite, user)
+	}
+
+	ok, err := models.UseGroupInvite(invite.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to join group",
+		})
+	}
+	if !ok {
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"error": "This invite link has expired",
+		})
+	}
+
+	// The membership check above can race with another join; only a real join keeps the use
+	joined, err := models.JoinGroup(group.ID, user.ID)
+	if err != nil || !joined {
+		models.RefundGroupInvite(invite.ID)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to join group",
+		})
+	}
+	if !joined {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "You are already a member of this group",
+		})
+	}
+	notifyMemberAdded(group, user)
+
+	return c.JSON(fiber.Map{
+		"message":  "Joined group successfully",
+		"group_id": group.ID,
+	})
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"github.com/vinneth/go-webchat/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxJoinRequestMessageLength = 500
+
+// JoinGroupRequest represents join group payload
+type JoinGroupRequest struct {
+	Message string `json:"message"` // Shown to admins when approval is required
+}
+
+// GroupJoinRequestWithGroup is one of the current user's join requests together with a preview of the group
+type GroupJoinRequestWithGroup struct {
+	models.GroupJoinRequest
+	Group *GroupPreview `json:"group,omitempty"`
+}
+
+// refundJoinRequestInvite gives back the invite link use a join request took, if it came through one
+func refundJoinRequestInvite(req *models.GroupJoinRequest) {
+	if !req.InviteID.IsZero() {
+		models.RefundGroupInvite(req.InviteID)
+	}
+}
+
+// findManagedGroup loads the group named in the route, if the current user may review its join requests
+func findManagedGroup(c *fiber.Ctx) (*models.Conversation, error) {
+	return findPermittedGroup(c, models.PermAddMembers, "You don't have permission to review join requests")
+}
+
+// findGroupJoinRequest loads the join request named in the route, for a group the current user manages
+func findGroupJoinRequest(c *fiber.Ctx) (*models.Conversation, *models.GroupJoinRequest, error) {
+	group, err := findManagedGroup(c)
+	if group == nil {
+		return nil, nil, err
+	}
+
+	requestID, err := primitive.ObjectIDFromHex(c.Params("requestId"))
+	if err != nil {
+		return nil, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request ID",
+		})
+	}
+
+	req, err := models.FindGroupJoinRequest(requestID, group.ID)
+	if err != nil || req == nil {
+		return nil, nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Join request not found",
+		})
+	}
+
+	return group, req, nil
+}
+
+// notifyJoinRequestReviewers sends an event to the members who can approve join requests
+func notifyJoinRequestReviewers(group *models.Conversation, build func(reviewerID primitive.ObjectID) websocket.WSMessage) {
+	for _, memberID := range group.Members {
+		if group.Can(memberID, models.PermAddMembers) {
+			websocket.Hub.SendToUser(memberID, build(memberID))
+		}
+	}
+}
+
+// requestToJoinGroup submits a request to join a group that requires approval through one of its invite links
+func requestToJoinGroup(c *fiber.Ctx, group *models.Conversation, invite *models.GroupInvite, user *models.User) error {
+	var body JoinGroupRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+
+	message := strings.TrimSpace(body.Message)
+	if utf8.RuneCountInString(message) > maxJoinRequestMessageLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Message must be at most %d characters", maxJoinRequestMessageLength),
+		})
+	}
+
+	req, err := models.CreateGroupJoinRequest(group.ID, user.ID, invite.ID, message)
+	if err == models.ErrJoinRequestExists {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "You have already asked to join this group",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send join request",
+		})
+	}
+
+	// Asking to join counts as a use of the link
+	ok, err := models.UseGroupInvite(invite.ID)
+	if err != nil || !ok {
+		models.DeleteGroupJoinRequest(req.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to send join request",
+			})
+		}
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"error": "This invite link has expired",
+		})
+	}
+
+	// Notify the members who can approve it
+	notifyJoinRequestReviewers(group, func(reviewerID primitive.ObjectID) websocket.WSMessage {
+		public := user.ToPublicFor(reviewerID, websocket.Hub.IsOnline(user.ID))
+		return websocket.WSMessage{
+			Type: "group:join_request",
+			Payload: map[string]interface{}{
+				"group_id": group.ID,
+				"request":  models.GroupJoinRequestWithUser{GroupJoinRequest: *req, User: &public},
+			},
+		}
+	})
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Your request to join has been sent",
+		"request": req,
+	})
+}
+
+// GetGroupJoinRequests lists a group's pending join requests, oldest first
+func GetGroupJoinRequests(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	group, err := findManagedGroup(c)
+	if group == nil {
+		return err
+	}
+
+	requests, err := models.GetGroupJoinRequests(group.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch join requests",
+		})
+	}
+
+	result := make([]models.GroupJoinRequestWithUser, 0, len(requests))
+	for _, req := range requests {
+		withUser := models.GroupJoinRequestWithUser{GroupJoinRequest: req}
+		if user, _ := models.FindUserByID(req.UserID); user != nil {
+			public := user.ToPublicFor(userID, websocket.Hub.IsOnline(user.ID))
+			withUser.User = &public
+		}
+		result = append(result, withUser)
+	}
+
+	return c.JSON(fiber.Map{
+		"requests": result,
+	})
+}
+
+// ApproveGroupJoinRequest adds the requester to the group
+func ApproveGroupJoinRequest(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	group, req, err := findGroupJoinRequest(c)
+	if req == nil {
+		return err
+	}
+
+	// Deleting first makes sure a request is only approved once
+	found, err := models.DeleteGroupJoinRequest(req.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to approve join request",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Join request not found",
+		})
+	}
+
+	user, err := models.FindUserByID(req.UserID)
+	if err != nil || user == nil || user.Deleted || user.IsSuspended() {
+		refundJoinRequestInvite(req)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if !group.HasMember(user.ID) {
+		if err := addMemberToGroup(group, user); err != nil {
+			refundJoinRequestInvite(req)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to add member",
+			})
+		}
+	}
+
+	notifyJoinRequestResolved(group, req, userID, true)
+
+	return c.JSON(fiber.Map{
+		"message": "Join request approved",
+	})
+}
+
+// RejectGroupJoinRequest declines a request to join the group
+func RejectGroupJoinRequest(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	group, req, err := findGroupJoinRequest(c)
+	if req == nil {
+		return err
+	}
+
+	found, err := models.DeleteGroupJoinRequest(req.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to reject join request",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Join request not found",
+		})
+	}
+
+	// A rejected request doesn't count against the link's uses
+	refundJoinRequestInvite(req)
+
+	// Notify the requester
+	websocket.Hub.SendToUser(req.UserID, websocket.WSMessage{
+		Type: "group:join_rejected",
+		Payload: map[string]interface{}{
+			"group_id":   group.ID,
+			"group_name": group.GroupName,
+		},
+	})
+
+	notifyJoinRequestResolved(group, req, userID, false)
+
+	return c.JSON(fiber.Map{
+		"message": "Join request rejected",
+	})
+}
+
+// GetMyGroupJoinRequests lists the current user's pending requests to join groups, newest first
+func GetMyGroupJoinRequests(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	requests, err := models.GetUserGroupJoinRequests(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch join requests",
+		})
+	}
+
+	result := make([]GroupJoinRequestWithGroup, 0, len(requests))
+	for _, req := range requests {
+		withGroup := GroupJoinRequestWithGroup{GroupJoinRequest: req}
+		if group, _ := models.FindConversationByID(req.GroupID); group != nil {
+			withGroup.Group = &GroupPreview{
+				ID:          group.ID,
+				Name:        group.GroupName,
+				Icon:        group.GroupIcon,
+				MemberCount: len(group.Members),
+			}
+		}
+		result = append(result, withGroup)
+	}
+
+	return c.JSON(fiber.Map{
+		"requests": result,
+	})
+}
+
+// CancelGroupJoinRequest withdraws one of the current user's requests to join a group
+func CancelGroupJoinRequest(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	requestID, err := primitive.ObjectIDFromHex(c.Params("requestId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request ID",
+		})
+	}
+
+	req, err := models.CancelGroupJoinRequest(requestID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to cancel join request",
+		})
+	}
+	if req == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Join request not found",
+		})
+	}
+
+	refundJoinRequestInvite(req)
+
+	// Take it off the reviewers' queue
+	if group, _ := models.FindConversationByID(req.GroupID); group != nil {
+		notifyJoinRequestReviewers(group, func(primitive.ObjectID) websocket.WSMessage {
+			return websocket.WSMessage{
+				Type: "group:join_request_cancelled",
+				Payload: map[string]interface{}{
+					"group_id":   group.ID,
+					"request_id": req.ID,
+				},
+			}
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Join request cancelled",
+	})
+}
+
+// notifyJoinRequestResolved tells the other reviewers that a join request has been handled
+func notifyJoinRequestResolved(group *models.Conversation, req *models.GroupJoinRequest, reviewerID primitive.ObjectID, approved bool) {
+	notifyJoinRequestReviewers(group, func(primitive.ObjectID) websocket.WSMessage {
+		return websocket.WSMessage{
+			Type: "group:join_request_resolved",
+			Payload: map[string]interface{}{
+				"group_id":    group.ID,
+				"request_id":  req.ID,
+				"approved":    approved,
+				"reviewed_by": reviewerID,
+			},
+		}
+	})
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"github.com/vinneth/go-webchat/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GroupRoleRequest represents promote or demote member payload
+type GroupRoleRequest struct {
+	Role models.GroupRole `json:"role"`
+}
+
+// TransferOwnershipRequest represents transfer group ownership payload
+type TransferOwnershipRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// findMemberGroup loads the group named in the route, if the current user is a member of it
+func findMemberGroup(c *fiber.Ctx) (*models.Conversation, error) {
+	userID := middleware.GetUserID(c)
+
+	groupID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid group ID",
+		})
+	}
+
+	group, err := models.FindConversationByID(groupID)
+	if err != nil || group == nil || group.Type != models.ConversationTypeGroup || !group.HasMember(userID) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Group not found",
+		})
+	}
+
+	return group, nil
+}
+
+// findPermittedGroup loads the group named in the route, if the current user's role grants perm
+func findPermittedGroup(c *fiber.Ctx, perm models.GroupPermission, denied string) (*models.Conversation, error) {
+	userID := middleware.GetUserID(c)
+
+	group, err := findMemberGroup(c)
+	if group == nil {
+		return nil, err
+	}
+
+	if !group.Can(userID, perm) {
+		return nil, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": denied,
+		})
+	}
+
+	return group, nil
+}
+
+// PromoteGroupMember raises a member to a higher role (moderator or admin)
+func PromoteGroupMember(c *fiber.Ctx) error {
+	return changeGroupRole(c, true)
+}
+
+// DemoteGroupMember lowers a member to a lower role (moderator or member, the default)
+func DemoteGroupMember(c *fiber.Ctx) error {
+	return changeGroupRole(c, false)
+}
+
+// changeGroupRole moves a member up or down the role hierarchy. Members with the
+// manage_roles permission can only change roles below their own, to roles below their own.
+func changeGroupRole(c *fiber.Ctx, promote bool) error {
+	userID := middleware.GetUserID(c)
+
+	group, err := findMemberGroup(c)
+	if group == nil {
+		return err
+	}
+
+	memberID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid member ID",
+		})
+	}
+
+	var req GroupRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.Role == "" && !promote {
+		req.Role = models.GroupRoleMember
+	}
+	if !models.ValidGroupRole(req.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Role must be admin, moderator or member",
+		})
+	}
+
+	current := group.RoleOf(memberID)
+	if current == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Member not found",
+		})
+	}
+
+	if promote && !req.Role.Outranks(current) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Member already has this role or a higher one",
+		})
+	}
+	if !promote && !current.Outranks(req.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Member already has this role or a lower one",
+		})
+	}
+
+	actor := group.RoleOf(userID)
+	if !group.Can(userID, models.PermManageRoles) || !actor.Outranks(current) || !actor.Outranks(req.Role) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You don't have permission to change this member's role",
+		})
+	}
+
+	found, err := models.SetGroupRole(group.ID, memberID, req.Role)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to change role",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Member not found",
+		})
+	}
+
+	// Notify members
+	websocket.Hub.SendToUsers(group.Members, websocket.WSMessage{
+		Type: "group:role_changed",
+		Payload: map[string]interface{}{
+			"group_id":   group.ID,
+			"member_id":  memberID,
+			"role":       req.Role,
+			"changed_by": userID,
+		},
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Role changed successfully",
+		"role":    req.Role,
+	})
+}
+
+// TransferGroupOwnership hands the group over to another member; the previous owner becomes an admin
+func TransferGroupOwnership(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	group, err := findMemberGroup(c)
+	if group == nil {
+		return err
+	}
+
+	if group.Owner != userID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the owner can transfer ownership",
+		})
+	}
+
+	var req TransferOwnershipRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	newOwnerID, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if newOwnerID == userID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You already own this group",
+		})
+	}
+
+	newOwner, err := models.FindUserByID(newOwnerID)
+	if err != nil || newOwner == nil || !group.HasMember(newOwnerID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Member not found",
+		})
+	}
+
+	if newOwner.IsBot || newOwner.Deleted {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Ownership can only be transferred to a person",
+		})
+	}
+
+	transferred, err := models.TransferGroupOwnership(group.ID, userID, newOwnerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to transfer ownership",
+		})
+	}
+	if !transferred {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Group membership changed; try again",
+		})
+	}
+
+	// Notify members
+	websocket.Hub.SendToUsers(group.Members, websocket.WSMessage{
+		Type: "group:owner_changed",
+		Payload: map[string]interface{}{
+			"group_id":          group.ID,
+			"owner_id":          newOwnerID,
+			"previous_owner_id": userID,
+		},
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Ownership transferred successfully",
+	})
+}
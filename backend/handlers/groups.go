@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/media"
 	"github.com/vinneth/go-webchat/middleware"
 	"github.com/vinneth/go-webchat/models"
 	"github.com/vinneth/go-webchat/websocket"
@@ -49,6 +50,12 @@ func CreateGroup(c *fiber.Ctx) error {
 		})
 	}
 
+	if req.Icon != "" && !validAvatarURL(req.Icon) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Icon must be an https URL",
+		})
+	}
+
 	// Convert member IDs
 	memberIDs := make([]primitive.ObjectID, 0, len(req.MemberIDs))
 	for _, idStr := range req.MemberIDs {
@@ -56,8 +63,8 @@ func CreateGroup(c *fiber.Ctx) error {
 		if err != nil {
 			continue
 		}
-		// Verify member exists
-		if _, err := models.FindUserByID(id); err == nil {
+		// Verify member exists; bots can only be added by their owner
+		if member, err := models.FindUserByID(id); err == nil && member != nil && (!member.IsBot || member.BotOwnerID == userID) {
 			memberIDs = append(memberIDs, id)
 		}
 	}
@@ -76,7 +83,7 @@ func CreateGroup(c *fiber.Ctx) error {
 		member, _ := models.FindUserByID(memberID)
 		if member != nil {
 			isOnline := websocket.Hub.IsOnline(member.ID)
-			membersList = append(membersList, member.ToPublic(isOnline))
+			membersList = append(membersList, member.ToPublicFor(userID, isOnline))
 		}
 	}
 
@@ -122,10 +129,9 @@ func UpdateGroup(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if user is admin
-	if group.Admin != userID {
+	if !group.Can(userID, models.PermEditGroupInfo) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Only admin can update group",
+			"error": "You don't have permission to edit this group",
 		})
 	}
 
@@ -136,12 +142,23 @@ func UpdateGroup(c *fiber.Ctx) error {
 		})
 	}
 
+	if req.Icon != "" && !validAvatarURL(req.Icon) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Icon must be an https URL",
+		})
+	}
+
 	if err := models.UpdateGroup(groupID, req.Name, req.Icon); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update group",
 		})
 	}
 
+	// An icon URL replaces any uploaded icon
+	if req.Icon != "" {
+		media.Delete(media.KindGroupIcon, group.IconMedia)
+	}
+
 	// Get updated group
 	updatedGroup, _ := models.FindConversationByID(groupID)
 
@@ -183,10 +200,9 @@ func AddGroupMember(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if user is admin
-	if group.Admin != userID {
+	if !group.Can(userID, models.PermAddMembers) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Only admin can add members",
+			"error": "You don't have permission to add members",
 		})
 	}
 
@@ -212,18 +228,41 @@ func AddGroupMember(c *fiber.Ctx) error {
 		})
 	}
 
+	if member.IsBot && member.BotOwnerID != userID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the bot's owner can add it to a group",
+		})
+	}
+
 	// Add member
-	if err := models.AddGroupMember(groupID, memberID); err != nil {
+	if err := addMemberToGroup(group, member); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to add member",
 		})
 	}
 
+	return c.JSON(fiber.Map{
+		"message": "Member added successfully",
+	})
+}
+
+// addMemberToGroup adds a user to a group and notifies them and the existing members
+func addMemberToGroup(group *models.Conversation, member *models.User) error {
+	if err := models.AddGroupMember(group.ID, member.ID); err != nil {
+		return err
+	}
+
+	notifyMemberAdded(group, member)
+	return nil
+}
+
+// notifyMemberAdded tells a new member and the existing members that they joined
+func notifyMemberAdded(group *models.Conversation, member *models.User) {
 	// Notify new member
-	websocket.Hub.SendToUser(memberID, websocket.WSMessage{
+	websocket.Hub.SendToUser(member.ID, websocket.WSMessage{
 		Type: "group:added",
 		Payload: map[string]interface{}{
-			"group_id":   groupID,
+			"group_id":   group.ID,
 			"group_name": group.GroupName,
 		},
 	})
@@ -233,15 +272,11 @@ func AddGroupMember(c *fiber.Ctx) error {
 		websocket.Hub.SendToUser(existingMemberID, websocket.WSMessage{
 			Type: "group:member_added",
 			Payload: map[string]interface{}{
-				"group_id": groupID,
-				"member":   member.ToPublic(websocket.Hub.IsOnline(memberID)),
+				"group_id": group.ID,
+				"member":   member.ToPublicFor(existingMemberID, websocket.Hub.IsOnline(member.ID)),
 			},
 		})
 	}
-
-	return c.JSON(fiber.Map{
-		"message": "Member added successfully",
-	})
 }
 
 // RemoveGroupMember removes a member from group
@@ -272,17 +307,18 @@ func RemoveGroupMember(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if user is admin or removing self
-	if group.Admin != userID && memberID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Only admin can remove other members",
+	// The owner can only leave after transferring ownership
+	if memberID == group.Owner {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot remove the group owner",
 		})
 	}
 
-	// Cannot remove admin
-	if memberID == group.Admin {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Cannot remove group admin",
+	// Members can remove themselves; removing others needs the permission and a higher role
+	if memberID != userID &&
+		(!group.Can(userID, models.PermRemoveMembers) || !group.RoleOf(userID).Outranks(group.RoleOf(memberID))) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You don't have permission to remove this member",
 		})
 	}
 
@@ -339,10 +375,10 @@ func LeaveGroup(c *fiber.Ctx) error {
 		})
 	}
 
-	// Admin cannot leave (must assign new admin first)
-	if group.Admin == userID {
+	// Owner cannot leave (must transfer ownership first)
+	if group.Owner == userID {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Admin cannot leave group. Transfer admin role first.",
+			"error": "Owner cannot leave group. Transfer ownership first.",
 		})
 	}
 
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+	"github.com/vinneth/go-webchat/config"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"github.com/vinneth/go-webchat/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxInviteUses     = 1000
+	maxInviteLifetime = 365 * 24 * time.Hour
+	maxQRCodeSize     = 1024
+)
+
+// CreateContactInviteRequest represents create contact invite payload
+type CreateContactInviteRequest struct {
+	MaxUses   int `json:"max_uses"`   // Zero for unlimited
+	ExpiresIn int `json:"expires_in"` // Seconds; zero for no expiry
+}
+
+// ContactInviteWithLink is an invite together with the link to share
+type ContactInviteWithLink struct {
+	models.ContactInvite
+	Link string `json:"link"`
+}
+
+// contactInviteLink returns the frontend link that redeems an invite token
+func contactInviteLink(token string) string {
+	return config.AppConfig.FrontendURL + "/invite/" + token
+}
+
+// findOwnedContactInvite loads the current user's invite named in the route
+func findOwnedContactInvite(c *fiber.Ctx) (*models.ContactInvite, error) {
+	userID := middleware.GetUserID(c)
+
+	inviteID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid invite ID",
+		})
+	}
+
+	invite, err := models.FindContactInvite(inviteID, userID)
+	if err != nil || invite == nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invite not found",
+		})
+	}
+
+	return invite, nil
+}
+
+// findUsableContactInvite loads the invite for the token in the route along with its owner
+func findUsableContactInvite(c *fiber.Ctx) (*models.ContactInvite, *models.User, error) {
+	invite, err := models.FindUsableContactInvite(c.Params("token"))
+	if err != nil {
+		return nil, nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to look up invite",
+		})
+	}
+	if invite == nil {
+		return nil, nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "This invite link is invalid or has expired",
+		})
+	}
+
+	owner, err := models.FindUserByID(invite.UserID)
+	if err != nil || owner == nil || owner.Deleted || owner.IsSuspended() {
+		return nil, nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "This invite link is invalid or has expired",
+		})
+	}
+
+	return invite, owner, nil
+}
+
+// CreateContactInvite creates a shareable invite link for the current user
+func CreateContactInvite(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req CreateContactInviteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.MaxUses < 0 || req.MaxUses > maxInviteUses {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Max uses must be between 0 and %d", maxInviteUses),
+		})
+	}
+
+	if req.ExpiresIn < 0 || req.ExpiresIn > int(maxInviteLifetime/time.Second) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invites can expire after at most a year",
+		})
+	}
+	lifetime := time.Duration(req.ExpiresIn) * time.Second
+
+	count, err := models.CountUserContactInvites(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create invite",
+		})
+	}
+	if count >= models.MaxContactInvitesPerUser {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You have too many invite links; revoke one first",
+		})
+	}
+
+	var expiresAt *time.Time
+	if lifetime > 0 {
+		t := time.Now().Add(lifetime)
+		expiresAt = &t
+	}
+
+	invite, err := models.CreateContactInvite(userID, req.MaxUses, expiresAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create invite",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"invite": ContactInviteWithLink{ContactInvite: *invite, Link: contactInviteLink(invite.Token)},
+	})
+}
+
+// GetContactInvites lists the current user's invite links
+func GetContactInvites(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	invites, err := models.GetUserContactInvites(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch invites",
+		})
+	}
+
+	result := make([]ContactInviteWithLink, 0, len(invites))
+	for _, invite := range invites {
+		result = append(result, ContactInviteWithLink{ContactInvite: invite, Link: contactInviteLink(invite.Token)})
+	}
+
+	return c.JSON(fiber.Map{
+		"invites": result,
+	})
+}
+
+// RevokeContactInvite deletes one of the current user's invite links
+func RevokeContactInvite(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	invite, err := findOwnedContactInvite(c)
+	if invite == nil {
+		return err
+	}
+
+	if _, err := models.DeleteContactInvite(invite.ID, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke invite",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Invite revoked successfully",
+	})
+}
+
+// GetContactInviteQRCode renders the link of one of the current user's invites as a QR code,
+// as PNG (the default) or SVG
+func GetContactInviteQRCode(c *fiber.Ctx) error {
+	invite, err := findOwnedContactInvite(c)
+	if invite == nil {
+		return err
+	}
+
+	code, err := qrcode.New(contactInviteLink(invite.Token), qrcode.Medium)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate QR code",
+		})
+	}
+
+	c.Set("Cache-Control", "private, no-store")
+
+	switch c.Query("format", "png") {
+	case "png":
+		size, _ := strconv.Atoi(c.Query("size", "256"))
+		if size <= 0 || size > maxQRCodeSize {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Size must be between 1 and %d", maxQRCodeSize),
+			})
+		}
+
+		png, err := code.PNG(size)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to generate QR code",
+			})
+		}
+		c.Set(fiber.HeaderContentType, "image/png")
+		return c.Send(png)
+
+	case "svg":
+		c.Set(fiber.HeaderContentType, "image/svg+xml")
+		return c.SendString(qrCodeSVG(code.Bitmap()))
+
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Format must be png or svg",
+		})
+	}
+}
+
+// qrCodeSVG renders QR code modules, including the quiet zone, as a scalable SVG image
+func qrCodeSVG(bitmap [][]bool) string {
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	n := len(bitmap)
+	return fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+			`<rect width="%d" height="%d" fill="#fff"/><path d="%s" fill="#000"/></svg>`,
+		n, n, n, n, path.String(),
+	)
+}
+
+// GetInvite resolves an invite token to the public profile of the user who shared it
+func GetInvite(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	invite, owner, err := findUsableContactInvite(c)
+	if invite == nil {
+		return err
+	}
+
+	// Don't reveal anything to users the owner has blocked
+	if owner.HasBlocked(userID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "This invite link is invalid or has expired",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"user": owner.ToPublicFor(userID, websocket.Hub.IsOnline(owner.ID)),
+	})
+}
+
+// AcceptInvite sends a contact request to the user who shared an invite link
+func AcceptInvite(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	invite, owner, err := findUsableContactInvite(c)
+	if invite == nil {
+		return err
+	}
+
+	return requestContact(c, userID, owner, invite)
+}
@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/middleware"
+)
+
+// GetJWKS publishes the public keys used to verify tokens
+func GetJWKS(c *fiber.Ctx) error {
+	// Short cache so rotated keys are picked up quickly
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(middleware.PublicJWKS())
+}
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/config"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"github.com/vinneth/go-webchat/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// deviceIDPattern restricts the client-chosen device IDs
+var deviceIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+const maxDeviceNameLength = 64
+
+// RegisterDeviceRequest represents register device keys payload
+type RegisterDeviceRequest struct {
+	Name           string              `json:"name"`
+	IdentityKey    string              `json:"identity_key"`
+	SignedPreKey   models.SignedPreKey `json:"signed_prekey"`
+	OneTimePreKeys []models.PreKey     `json:"one_time_prekeys"`
+}
+
+// UploadPreKeysRequest represents upload one-time prekeys payload
+type UploadPreKeysRequest struct {
+	OneTimePreKeys []models.PreKey `json:"one_time_prekeys"`
+}
+
+// OwnDevice is one of the current user's devices, with its remaining prekeys
+type OwnDevice struct {
+	models.DeviceKeys
+	OneTimePreKeyCount int `json:"one_time_prekey_count"`
+}
+
+// validPreKeys checks a batch of uploaded one-time prekeys
+func validPreKeys(preKeys []models.PreKey) bool {
+	if len(preKeys) > models.MaxOneTimePreKeys {
+		return false
+	}
+	for _, preKey := range preKeys {
+		if !models.ValidPublicKey(preKey.PublicKey) {
+			return false
+		}
+	}
+	return true
+}
+
+// notifyKeysChanged tells the user's encrypted chat partners to refresh their keys
+func notifyKeysChanged(userID primitive.ObjectID) {
+	conversations, err := models.GetUserConversations(userID)
+	if err != nil {
+		return
+	}
+
+	for _, conv := range conversations {
+		if !conv.Encrypted {
+			continue
+		}
+		for _, memberID := range conv.Members {
+			websocket.Hub.SendToUser(memberID, websocket.WSMessage{
+				Type: "keys:changed",
+				Payload: map[string]interface{}{
+					"conversation_id": conv.ID,
+					"user_id":         userID,
+				},
+			})
+		}
+	}
+}
+
+// GetDevices returns the current user's registered devices
+func GetDevices(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	devices, err := models.GetUserDevices(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch devices",
+		})
+	}
+
+	result := make([]OwnDevice, 0, len(devices))
+	for _, device := range devices {
+		result = append(result, OwnDevice{DeviceKeys: device, OneTimePreKeyCount: len(device.OneTimePreKeys)})
+	}
+
+	return c.JSON(fiber.Map{
+		"devices": result,
+	})
+}
+
+// RegisterDevice publishes the public keys of one of the current user's devices.
+// Registering an existing device again replaces all of its keys.
+func RegisterDevice(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	deviceID := c.Params("deviceId")
+
+	if !deviceIDPattern.MatchString(deviceID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid device ID",
+		})
+	}
+
+	var req RegisterDeviceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if !models.ValidPublicKey(req.IdentityKey) ||
+		!models.ValidPublicKey(req.SignedPreKey.PublicKey) ||
+		!models.ValidPublicKey(req.SignedPreKey.Signature) ||
+		!validPreKeys(req.OneTimePreKeys) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid keys",
+		})
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if utf8.RuneCountInString(name) > maxDeviceNameLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Device name must be at most %d characters", maxDeviceNameLength),
+		})
+	}
+
+	existing, err := models.FindDeviceKeys(userID, deviceID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to register device",
+		})
+	}
+
+	if existing == nil {
+		count, err := models.CountUserDevices(userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to register device",
+			})
+		}
+		if count >= models.MaxDevicesPerUser {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Too many devices registered",
+			})
+		}
+	}
+
+	device := &models.DeviceKeys{
+		UserID:         userID,
+		DeviceID:       deviceID,
+		Name:           name,
+		IdentityKey:    req.IdentityKey,
+		SignedPreKey:   req.SignedPreKey,
+		OneTimePreKeys: req.OneTimePreKeys,
+	}
+	if err := models.SaveDeviceKeys(device); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to register device",
+		})
+	}
+
+	// A new or changed identity key must be picked up by chat partners
+	if existing == nil || existing.IdentityKey != device.IdentityKey {
+		notifyKeysChanged(userID)
+	}
+
+	return c.JSON(fiber.Map{
+		"device": OwnDevice{DeviceKeys: *device, OneTimePreKeyCount: len(device.OneTimePreKeys)},
+	})
+}
+
+// UploadPreKeys adds one-time prekeys to one of the current user's devices
+func UploadPreKeys(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req UploadPreKeysRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if len(req.OneTimePreKeys) == 0 || !validPreKeys(req.OneTimePreKeys) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid keys",
+		})
+	}
+
+	found, err := models.AddOneTimePreKeys(userID, c.Params("deviceId"), req.OneTimePreKeys)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to upload prekeys",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Device not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Prekeys uploaded successfully",
+	})
+}
+
+// DeleteDevice removes one of the current user's devices from the key directory
+func DeleteDevice(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	deleted, err := models.DeleteDeviceKeys(userID, c.Params("deviceId"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete device",
+		})
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Device not found",
+		})
+	}
+
+	notifyKeysChanged(userID)
+
+	return c.JSON(fiber.Map{
+		"message": "Device deleted successfully",
+	})
+}
+
+// findKeyTarget parses the user whose keys are requested. Keys are only handed out to the
+// user's own devices and to users they are connected with, and never across a block.
+func findKeyTarget(c *fiber.Ctx) (primitive.ObjectID, error) {
+	userID := middleware.GetUserID(c)
+
+	targetID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return primitive.NilObjectID, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if targetID == userID {
+		return targetID, nil
+	}
+
+	notFound := func() error {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if blocked, err := models.IsBlockedBetween(userID, targetID); err != nil || blocked {
+		return primitive.NilObjectID, notFound()
+	}
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return primitive.NilObjectID, notFound()
+	}
+	if !user.HasContact(targetID) {
+		shared, err := models.SharesConversation(userID, targetID)
+		if err != nil || !shared {
+			return primitive.NilObjectID, notFound()
+		}
+	}
+
+	return targetID, nil
+}
+
+// preKeyClaimPolicy limits how often a user can claim another user's prekeys
+func preKeyClaimPolicy() models.ThrottlePolicy {
+	window := config.AppConfig.PreKeyClaimWindow
+	return models.ThrottlePolicy{
+		MaxAttempts: config.AppConfig.PreKeyClaimMaxAttempts,
+		Window:      window,
+		Lockout:     window,
+		MaxLockout:  window,
+	}
+}
+
+func preKeyClaimThrottleKey(userID, targetID primitive.ObjectID) string {
+	return "prekeys:" + userID.Hex() + ":" + targetID.Hex()
+}
+
+// GetUserKeys returns the public identity keys of another user's devices
+func GetUserKeys(c *fiber.Ctx) error {
+	targetID, err := findKeyTarget(c)
+	if targetID.IsZero() {
+		return err
+	}
+
+	devices, err := models.GetUserDevices(targetID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch keys",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"devices": devices,
+	})
+}
+
+// ClaimPreKeyBundles hands out a prekey bundle for each of another user's devices
+func ClaimPreKeyBundles(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	targetID, err := findKeyTarget(c)
+	if targetID.IsZero() {
+		return err
+	}
+
+	// Each claim uses up one-time prekeys, so claims are throttled per caller and target
+	throttleKey := preKeyClaimThrottleKey(userID, targetID)
+	if retryAfter, _, err := models.RecordThrottleHit(throttleKey, preKeyClaimPolicy()); err == nil && retryAfter > 0 {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":       "Too many prekey requests for this user. Please try again later.",
+			"retry_after": seconds,
+		})
+	}
+
+	bundles, err := models.ClaimPreKeyBundles(targetID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch prekey bundles",
+		})
+	}
+
+	if len(bundles) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User has no registered devices",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"bundles": bundles,
+	})
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/config"
+	"github.com/vinneth/go-webchat/media"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"github.com/vinneth/go-webchat/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// storeUploadedImage reads the "image" form file and stores its thumbnails, returning the media ID
+func storeUploadedImage(c *fiber.Ctx, kind string) (string, error) {
+	fileHeader, err := c.FormFile("image")
+	if err != nil {
+		return "", c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Image file is required",
+		})
+	}
+
+	if fileHeader.Size > int64(config.AppConfig.MaxUploadSize) {
+		return "", c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": "Image is too large",
+		})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return "", c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to read image",
+		})
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, int64(config.AppConfig.MaxUploadSize)+1))
+	if err != nil || len(data) > config.AppConfig.MaxUploadSize {
+		return "", c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to read image",
+		})
+	}
+
+	mediaID, err := media.StoreImage(kind, data)
+	if err == media.ErrInvalidImage {
+		return "", c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Upload a JPEG, PNG or GIF image of up to 4096x4096 pixels",
+		})
+	}
+	if err != nil {
+		return "", c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store image",
+		})
+	}
+
+	return mediaID, nil
+}
+
+// UploadAvatar replaces the current user's avatar with an uploaded image
+func UploadAvatar(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	mediaID, err := storeUploadedImage(c, media.KindAvatar)
+	if mediaID == "" {
+		return err
+	}
+
+	oldMedia := user.AvatarMedia
+	user.Avatar = media.URL(media.KindAvatar, mediaID, media.DefaultSize)
+	user.AvatarMedia = mediaID
+
+	if err := models.UpdateAvatar(userID, user.Avatar, mediaID); err != nil {
+		media.Delete(media.KindAvatar, mediaID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update avatar",
+		})
+	}
+	media.Delete(media.KindAvatar, oldMedia)
+
+	broadcastUserUpdated(user)
+
+	return c.JSON(fiber.Map{
+		"message": "Avatar updated successfully",
+		"avatar":  user.Avatar,
+		"sizes":   media.URLs(media.KindAvatar, mediaID),
+	})
+}
+
+// UploadGroupIcon replaces a group's icon with an uploaded image
+func UploadGroupIcon(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	groupID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid group ID",
+		})
+	}
+
+	group, err := models.FindConversationByID(groupID)
+	if err != nil || group == nil || group.Type != models.ConversationTypeGroup {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Group not found",
+		})
+	}
+
+	if !group.Can(userID, models.PermEditGroupInfo) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You don't have permission to edit this group",
+		})
+	}
+
+	mediaID, err := storeUploadedImage(c, media.KindGroupIcon)
+	if mediaID == "" {
+		return err
+	}
+
+	icon := media.URL(media.KindGroupIcon, mediaID, media.DefaultSize)
+	if err := models.SetGroupIcon(groupID, icon, mediaID); err != nil {
+		media.Delete(media.KindGroupIcon, mediaID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update group icon",
+		})
+	}
+	media.Delete(media.KindGroupIcon, group.IconMedia)
+
+	// Notify members
+	for _, memberID := range group.Members {
+		websocket.Hub.SendToUser(memberID, websocket.WSMessage{
+			Type: "group:updated",
+			Payload: map[string]interface{}{
+				"group_id": groupID,
+				"name":     group.GroupName,
+				"icon":     icon,
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Group icon updated successfully",
+		"icon":    icon,
+		"sizes":   media.URLs(media.KindGroupIcon, mediaID),
+	})
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"github.com/vinneth/go-webchat/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// findConversationMessage loads the conversation and message named in the route,
+// if the current user is a member of the conversation
+func findConversationMessage(c *fiber.Ctx) (*models.Conversation, *models.Message, error) {
+	userID := middleware.GetUserID(c)
+
+	convID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid conversation ID",
+		})
+	}
+
+	msgID, err := primitive.ObjectIDFromHex(c.Params("messageId"))
+	if err != nil {
+		return nil, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid message ID",
+		})
+	}
+
+	conv, err := models.FindConversationByID(convID)
+	if err != nil || conv == nil || !conv.HasMember(userID) {
+		return nil, nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+
+	msg, err := models.FindMessageByID(msgID)
+	if err != nil || msg == nil || msg.ConversationID != convID {
+		return nil, nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Message not found",
+		})
+	}
+
+	return conv, msg, nil
+}
+
+// DeleteMessage deletes a message for everyone. Anyone can delete their own messages;
+// in groups, members with the delete_messages permission can delete those of lower roles.
+func DeleteMessage(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	conv, msg, err := findConversationMessage(c)
+	if msg == nil {
+		return err
+	}
+
+	if msg.SenderID != userID {
+		allowed := conv.Type == models.ConversationTypeGroup &&
+			conv.Can(userID, models.PermDeleteMessages) &&
+			conv.RoleOf(userID).Outranks(conv.RoleOf(msg.SenderID))
+		if !allowed {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You don't have permission to delete this message",
+			})
+		}
+	}
+
+	if err := models.DeleteMessage(msg.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete message",
+		})
+	}
+	models.UnpinMessage(conv.ID, msg.ID)
+
+	// Notify conversation members
+	websocket.Hub.BroadcastToConversation(conv.ID, websocket.WSMessage{
+		Type: "message:deleted",
+		Payload: map[string]interface{}{
+			"conversation_id": conv.ID,
+			"message_id":      msg.ID,
+			"deleted_by":      userID,
+		},
+	}, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "Message deleted successfully",
+	})
+}
+
+// PinMessage pins a message in a conversation
+func PinMessage(c *fiber.Ctx) error {
+	return setMessagePinned(c, true)
+}
+
+// UnpinMessage unpins a message in a conversation
+func UnpinMessage(c *fiber.Ctx) error {
+	return setMessagePinned(c, false)
+}
+
+// setMessagePinned pins or unpins a message. Anyone in a private chat can pin;
+// in groups it takes the pin_messages permission.
+func setMessagePinned(c *fiber.Ctx, pinned bool) error {
+	userID := middleware.GetUserID(c)
+
+	conv, msg, err := findConversationMessage(c)
+	if msg == nil {
+		return err
+	}
+
+	if conv.Type == models.ConversationTypeGroup && !conv.Can(userID, models.PermPinMessages) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You don't have permission to pin messages",
+		})
+	}
+
+	eventType := "message:unpinned"
+	if pinned {
+		eventType = "message:pinned"
+		ok, err := models.PinMessage(conv.ID, msg.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to pin message",
+			})
+		}
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("At most %d messages can be pinned", models.MaxPinnedMessages),
+			})
+		}
+	} else if err := models.UnpinMessage(conv.ID, msg.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unpin message",
+		})
+	}
+
+	// Notify conversation members
+	websocket.Hub.BroadcastToConversation(conv.ID, websocket.WSMessage{
+		Type: eventType,
+		Payload: map[string]interface{}{
+			"conversation_id": conv.ID,
+			"message_id":      msg.ID,
+			"user_id":         userID,
+		},
+	}, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "Message updated successfully",
+		"pinned":  pinned,
+	})
+}
@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/config"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"github.com/vinneth/go-webchat/oauth"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oauthStateCookie = "oauth_state"
+	oauthStateTTL    = 10 * time.Minute
+)
+
+// oauthState is kept in a short-lived cookie between the redirect and the callback
+type oauthState struct {
+	Provider string `json:"p"`
+	State    string `json:"s"`
+	Verifier string `json:"v"`
+	// Link is set when a signed-in user is adding this provider to their account
+	Link bool `json:"l,omitempty"`
+}
+
+// setOAuthStateCookie stores the state and PKCE verifier for the callback
+func setOAuthStateCookie(c *fiber.Ctx, state oauthState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthStateCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(data),
+		Path:     "/api/auth",
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		Secure:   config.AppConfig.Env == "production",
+		HTTPOnly: true,
+		// Lax so the cookie is sent on the provider's top-level redirect back to us
+		SameSite: "Lax",
+	})
+	return nil
+}
+
+// popOAuthStateCookie reads and clears the state cookie
+func popOAuthStateCookie(c *fiber.Ctx) (*oauthState, bool) {
+	value := c.Cookies(oauthStateCookie)
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthStateCookie,
+		Value:    "",
+		Path:     "/api/auth",
+		MaxAge:   -1,
+		HTTPOnly: true,
+	})
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, false
+	}
+
+	var state oauthState
+	if err := json.Unmarshal(data, &state); err != nil || state.State == "" || state.Verifier == "" {
+		return nil, false
+	}
+	return &state, true
+}
+
+// oauthError redirects back to the frontend login page with an error code
+func oauthError(c *fiber.Ctx, code string) error {
+	return c.Redirect(config.AppConfig.FrontendURL + "/login?error=" + code)
+}
+
+// beginOAuth redirects the user to the provider with a fresh state and PKCE challenge
+func beginOAuth(c *fiber.Ctx, providerName string, link bool) error {
+	provider, ok := oauth.Get(providerName)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Unknown sign-in provider",
+		})
+	}
+
+	stateToken, err := models.NewRandomToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to start sign-in",
+		})
+	}
+
+	state := oauthState{
+		Provider: providerName,
+		State:    stateToken,
+		Verifier: oauth2.GenerateVerifier(),
+		Link:     link,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	url, err := provider.AuthCodeURL(ctx, state.State, state.Verifier)
+	if err != nil {
+		log.Printf("OAuth provider %s unavailable: %v", providerName, err)
+		return oauthError(c, "provider_unavailable")
+	}
+
+	if err := setOAuthStateCookie(c, state); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to start sign-in",
+		})
+	}
+
+	return c.Redirect(url)
+}
+
+// verifyOAuthCallback checks the callback against the state cookie and exchanges the code
+// for the user's info. On failure it returns the error code to send back to the frontend.
+func verifyOAuthCallback(c *fiber.Ctx, providerName string) (*oauthState, *oauth.UserInfo, string) {
+	provider, ok := oauth.Get(providerName)
+	if !ok {
+		return nil, nil, "unknown_provider"
+	}
+
+	state, ok := popOAuthStateCookie(c)
+	if !ok || state.Provider != providerName ||
+		subtle.ConstantTimeCompare([]byte(state.State), []byte(c.Query("state"))) != 1 {
+		return nil, nil, "invalid_state"
+	}
+
+	if c.Query("error") != "" {
+		return nil, nil, "access_denied"
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		return nil, nil, "no_code"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	info, err := provider.Exchange(ctx, code, state.Verifier)
+	if err != nil {
+		log.Printf("OAuth exchange with %s failed: %v", providerName, err)
+		return nil, nil, "exchange_failed"
+	}
+
+	return state, info, ""
+}
+
+// completeOAuth verifies the callback, signs the user in and redirects to the frontend
+func completeOAuth(c *fiber.Ctx, providerName string) error {
+	state, info, errCode := verifyOAuthCallback(c, providerName)
+	if errCode != "" {
+		return oauthError(c, errCode)
+	}
+
+	identity := models.Identity{
+		Provider: providerName,
+		Subject:  info.Subject,
+		Email:    info.Email,
+	}
+
+	if state.Link {
+		return linkOAuthIdentity(c, identity)
+	}
+
+	// Sign in with an already linked identity
+	user, err := models.FindUserByIdentity(providerName, info.Subject)
+	if err != nil {
+		return oauthError(c, "lookup_failed")
+	}
+
+	if user == nil {
+		if info.Email == "" {
+			return oauthError(c, "email_required")
+		}
+
+		existing, _ := models.FindUserByEmail(info.Email)
+		switch {
+		case existing == nil:
+			// Create new user
+			user = &models.User{
+				Email:         info.Email,
+				Name:          info.Name,
+				Avatar:        info.Picture,
+				AuthProvider:  providerName,
+				EmailVerified: info.EmailVerified,
+				Identities:    []models.Identity{identity},
+			}
+			if err := models.CreateUser(user); err != nil {
+				return oauthError(c, "create_failed")
+			}
+
+		case existing.AuthProvider == providerName && !existing.HasIdentity(providerName) && info.EmailVerified:
+			// Accounts created with this provider before identities were tracked
+			if err := models.LinkIdentity(existing.ID, identity); err != nil {
+				return oauthError(c, "link_failed")
+			}
+			user = existing
+
+		default:
+			// Never sign in to an existing account by email alone; the owner must link it first
+			return oauthError(c, "account_exists")
+		}
+	}
+
+	if user.IsSuspended() {
+		return oauthError(c, "account_suspended")
+	}
+
+	// Start session and set cookie
+	if _, err := startSession(c, user, true); err != nil {
+		return oauthError(c, "token_failed")
+	}
+
+	// Redirect to frontend
+	return c.Redirect(config.AppConfig.FrontendURL + "/chat")
+}
+
+// linkOAuthIdentity adds an identity to the account signed in on this browser
+func linkOAuthIdentity(c *fiber.Ctx, identity models.Identity) error {
+	tokenString := middleware.TokenFromRequest(c)
+	if tokenString == "" {
+		return oauthError(c, "not_authenticated")
+	}
+
+	_, session, err := middleware.Authenticate(tokenString)
+	if err != nil {
+		return oauthError(c, "not_authenticated")
+	}
+
+	owner, err := models.FindUserByIdentity(identity.Provider, identity.Subject)
+	if err != nil {
+		return oauthError(c, "lookup_failed")
+	}
+	if owner != nil && owner.ID != session.UserID {
+		return linkResult(c, "error", "identity_in_use")
+	}
+
+	if owner == nil {
+		switch err := models.LinkIdentity(session.UserID, identity); err {
+		case nil:
+		case models.ErrIdentityInUse:
+			return linkResult(c, "error", "identity_in_use")
+		case models.ErrProviderAlreadyLinked:
+			return linkResult(c, "error", "provider_already_linked")
+		default:
+			return linkResult(c, "error", "link_failed")
+		}
+	}
+
+	return linkResult(c, "linked", identity.Provider)
+}
+
+// linkResult redirects back to the frontend after a link attempt
+func linkResult(c *fiber.Ctx, key, value string) error {
+	return c.Redirect(config.AppConfig.FrontendURL + "/chat?" + key + "=" + value)
+}
+
+// GetOAuthProviders lists the configured sign-in providers
+func GetOAuthProviders(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"providers": oauth.Names(),
+	})
+}
+
+// OAuthLogin redirects to the provider named in the route
+func OAuthLogin(c *fiber.Ctx) error {
+	return beginOAuth(c, c.Params("provider"), false)
+}
+
+// OAuthLink starts linking the provider named in the route to the current account
+func OAuthLink(c *fiber.Ctx) error {
+	return beginOAuth(c, c.Params("provider"), true)
+}
+
+// OAuthCallback handles the callback of the provider named in the route
+func OAuthCallback(c *fiber.Ctx) error {
+	return completeOAuth(c, c.Params("provider"))
+}
+
+// GoogleLogin redirects to Google OAuth
+func GoogleLogin(c *fiber.Ctx) error {
+	return beginOAuth(c, "google", false)
+}
+
+// GoogleCallback handles Google OAuth callback
+func GoogleCallback(c *fiber.Ctx) error {
+	return completeOAuth(c, "google")
+}
+
+// GetIdentities lists the sign-in methods linked to the current account
+func GetIdentities(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	identities := user.Identities
+	if identities == nil {
+		identities = []models.Identity{}
+	}
+
+	return c.JSON(fiber.Map{
+		"identities":   identities,
+		"has_password": user.HasPassword(),
+		"providers":    oauth.Names(),
+	})
+}
+
+// UnlinkIdentity removes a linked provider from the current account
+func UnlinkIdentity(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	provider := c.Params("provider")
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if !user.HasIdentity(provider) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "This provider is not linked to your account",
+		})
+	}
+
+	if err := models.UnlinkIdentity(userID, provider); err != nil {
+		if err == models.ErrLastLoginMethod {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "You can't remove your last sign-in method. Set a password or link another provider first.",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unlink provider",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Provider unlinked successfully",
+	})
+}
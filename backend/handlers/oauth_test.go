@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/config"
+	"github.com/vinneth/go-webchat/oauth"
+)
+
+const (
+	testClientID     = "test-client"
+	testClientSecret = "test-secret"
+	testAuthCode     = "test-code"
+	testAccessToken  = "test-access-token"
+)
+
+// mockOIDCServer is a minimal OpenID Connect provider that checks the PKCE verifier
+type mockOIDCServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	challenge string
+}
+
+func newMockOIDCServer(t *testing.T) *mockOIDCServer {
+	t.Helper()
+
+	m := &mockOIDCServer{}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"userinfo_endpoint":      m.URL + "/userinfo",
+		})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "bad form", http.StatusBadRequest)
+			return
+		}
+
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok {
+			clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+		if clientID != testClientID || clientSecret != testClientSecret {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+
+		// The S256 challenge sent to /authorize must match the verifier sent here
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		m.mu.Lock()
+		challenge := m.challenge
+		m.mu.Unlock()
+		if r.PostForm.Get("code") != testAuthCode || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": testAccessToken,
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	})
+
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testAccessToken {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"sub":"user-123","email":"ada@example.com","email_verified":"true","preferred_username":"ada","picture":"https://example.com/ada.png"}`))
+	})
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// setChallenge records the code challenge the user agent was redirected with
+func (m *mockOIDCServer) setChallenge(challenge string) {
+	m.mu.Lock()
+	m.challenge = challenge
+	m.mu.Unlock()
+}
+
+// newOAuthTestApp configures a "mock" provider for the server and mounts the login and callback routes
+func newOAuthTestApp(t *testing.T, server *mockOIDCServer) *fiber.App {
+	t.Helper()
+
+	previous := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = previous })
+
+	config.AppConfig = &config.Config{
+		FrontendURL: "http://frontend.test",
+		APIURL:      "http://api.test",
+		OAuthProviders: []config.OAuthProviderConfig{{
+			Name:         "mock",
+			ClientID:     testClientID,
+			ClientSecret: testClientSecret,
+			Issuer:       server.URL,
+		}},
+	}
+	oauth.Init()
+
+	app := fiber.New()
+	app.Get("/api/auth/oauth/:provider", OAuthLogin)
+	// Stops after verifying the callback, before anything touches the database
+	app.Get("/api/auth/oauth/:provider/callback", func(c *fiber.Ctx) error {
+		_, info, errCode := verifyOAuthCallback(c, c.Params("provider"))
+		if errCode != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": errCode})
+		}
+		return c.JSON(info)
+	})
+	return app
+}
+
+// startOAuth follows the login route and returns the provider redirect and the state cookie
+func startOAuth(t *testing.T, app *fiber.App, server *mockOIDCServer) (*url.URL, *http.Cookie) {
+	t.Helper()
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/auth/oauth/mock", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("login status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := location.Scheme+"://"+location.Host+location.Path, server.URL+"/authorize"; got != want {
+		t.Fatalf("redirected to %s, want discovered endpoint %s", got, want)
+	}
+
+	query := location.Query()
+	if query.Get("client_id") != testClientID {
+		t.Errorf("client_id = %q, want %q", query.Get("client_id"), testClientID)
+	}
+	if query.Get("redirect_uri") != "http://api.test/api/auth/oauth/mock/callback" {
+		t.Errorf("redirect_uri = %q", query.Get("redirect_uri"))
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("missing S256 code challenge in %s", location)
+	}
+	if query.Get("state") == "" {
+		t.Fatal("missing state parameter")
+	}
+	server.setChallenge(query.Get("code_challenge"))
+
+	var stateCookie *http.Cookie
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == oauthStateCookie {
+			stateCookie = cookie
+		}
+	}
+	if stateCookie == nil || stateCookie.Value == "" {
+		t.Fatal("state cookie not set")
+	}
+	if !stateCookie.HttpOnly || stateCookie.Path != "/api/auth" {
+		t.Errorf("state cookie must be HttpOnly and scoped to /api/auth, got %+v", stateCookie)
+	}
+
+	return location, stateCookie
+}
+
+// callback calls the callback route as the provider's redirect would
+func callback(t *testing.T, app *fiber.App, query url.Values, cookie *http.Cookie) (int, map[string]interface{}) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/oauth/mock/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+
+	resp, err := app.Test(req, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestOAuthFlow(t *testing.T) {
+	server := newMockOIDCServer(t)
+	app := newOAuthTestApp(t, server)
+
+	location, cookie := startOAuth(t, app, server)
+
+	status, body := callback(t, app, url.Values{
+		"code":  {testAuthCode},
+		"state": {location.Query().Get("state")},
+	}, cookie)
+	if status != http.StatusOK {
+		t.Fatalf("callback status = %d, body = %v", status, body)
+	}
+
+	want := map[string]interface{}{
+		"Subject":       "user-123",
+		"Email":         "ada@example.com",
+		"EmailVerified": true,
+		"Name":          "ada",
+		"Picture":       "https://example.com/ada.png",
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("%s = %v, want %v", key, body[key], value)
+		}
+	}
+}
+
+func TestOAuthCallbackRejectsBadState(t *testing.T) {
+	server := newMockOIDCServer(t)
+	app := newOAuthTestApp(t, server)
+
+	location, cookie := startOAuth(t, app, server)
+	state := location.Query().Get("state")
+
+	tests := []struct {
+		name   string
+		query  url.Values
+		cookie *http.Cookie
+		want   string
+	}{
+		{"wrong state", url.Values{"code": {testAuthCode}, "state": {state + "x"}}, cookie, "invalid_state"},
+		{"missing cookie", url.Values{"code": {testAuthCode}, "state": {state}}, nil, "invalid_state"},
+		{"provider error", url.Values{"error": {"access_denied"}, "state": {state}}, cookie, "access_denied"},
+		{"missing code", url.Values{"state": {state}}, cookie, "no_code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := callback(t, app, tt.query, tt.cookie)
+			if status != http.StatusBadRequest || body["error"] != tt.want {
+				t.Errorf("got %d %v, want error %q", status, body, tt.want)
+			}
+		})
+	}
+}
+
+func TestOAuthCallbackRejectsWrongVerifier(t *testing.T) {
+	server := newMockOIDCServer(t)
+	app := newOAuthTestApp(t, server)
+
+	location, cookie := startOAuth(t, app, server)
+
+	// A code intercepted from another sign-in can't be redeemed with this cookie's verifier
+	server.setChallenge(strings.Repeat("A", 43))
+
+	status, body := callback(t, app, url.Values{
+		"code":  {testAuthCode},
+		"state": {location.Query().Get("state")},
+	}, cookie)
+	if status != http.StatusBadRequest || body["error"] != "exchange_failed" {
+		t.Errorf("got %d %v, want exchange_failed", status, body)
+	}
+}
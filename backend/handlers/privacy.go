@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UpdatePrivacyRequest represents update privacy payload; omitted fields are left unchanged
+type UpdatePrivacyRequest struct {
+	Discoverability *string `json:"discoverability"`
+	LastSeen        *string `json:"last_seen"`
+	Online          *string `json:"online"`
+	ProfilePhoto    *string `json:"profile_photo"`
+	ReadReceipts    *bool   `json:"read_receipts"`
+}
+
+// hiddenReaders returns the members of a conversation whose reads other members may not see
+func hiddenReaders(conv *models.Conversation) []primitive.ObjectID {
+	hidden, _ := models.GetUsersWithoutReadReceipts(conv.Members)
+	return hidden
+}
+
+// GetPrivacy returns the current user's privacy settings
+func GetPrivacy(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"privacy": user.Privacy.WithDefaults(),
+	})
+}
+
+// UpdatePrivacy changes the current user's privacy settings
+func UpdatePrivacy(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req UpdatePrivacyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	privacy := user.Privacy.WithDefaults()
+	if req.Discoverability != nil {
+		if !models.ValidDiscoverability(*req.Discoverability) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Discoverability must be everyone, contacts_of_contacts or nobody",
+			})
+		}
+		privacy.Discoverability = *req.Discoverability
+	}
+
+	for _, setting := range []struct {
+		value  *string
+		target *string
+	}{
+		{req.LastSeen, &privacy.LastSeen},
+		{req.Online, &privacy.Online},
+		{req.ProfilePhoto, &privacy.ProfilePhoto},
+	} {
+		if setting.value == nil {
+			continue
+		}
+		if !models.ValidVisibility(*setting.value) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Visibility must be everyone, contacts or nobody",
+			})
+		}
+		*setting.target = *setting.value
+	}
+
+	if req.ReadReceipts != nil {
+		privacy.ReadReceipts = req.ReadReceipts
+	}
+
+	if err := models.UpdatePrivacy(userID, privacy); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update privacy settings",
+		})
+	}
+
+	// Contacts and group members may now see more or less of the profile
+	user.Privacy = privacy
+	broadcastUserUpdated(user)
+
+	return c.JSON(fiber.Map{
+		"message": "Privacy settings updated successfully",
+		"privacy": privacy,
+	})
+}
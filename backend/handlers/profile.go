@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/media"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"github.com/vinneth/go-webchat/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxNameLength   = 50
+	maxBioLength    = 160
+	maxAvatarLength = 512
+)
+
+// UpdateProfileRequest represents update profile payload; omitted fields are left unchanged
+type UpdateProfileRequest struct {
+	Name   *string `json:"name"`
+	Bio    *string `json:"bio"`
+	Avatar *string `json:"avatar"` // Only "" is accepted, to reset; new avatars are uploaded to /api/me/avatar
+}
+
+// validAvatarURL reports whether an image is an absolute https URL
+func validAvatarURL(avatar string) bool {
+	if len(avatar) > maxAvatarLength {
+		return false
+	}
+	u, err := url.Parse(avatar)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// broadcastUserUpdated sends a user's new public profile to their contacts and the members of their groups
+func broadcastUserUpdated(user *models.User) {
+	recipients := map[primitive.ObjectID]bool{user.ID: true}
+	for _, entry := range user.Contacts {
+		recipients[entry.UserID] = true
+	}
+
+	conversations, _ := models.GetUserConversations(user.ID)
+	for _, conv := range conversations {
+		if conv.Type != models.ConversationTypeGroup {
+			continue
+		}
+		for _, memberID := range conv.Members {
+			recipients[memberID] = true
+		}
+	}
+
+	isOnline := websocket.Hub.IsOnline(user.ID)
+	for recipientID := range recipients {
+		websocket.Hub.SendToUser(recipientID, websocket.WSMessage{
+			Type: "user:updated",
+			Payload: map[string]interface{}{
+				"user": user.ToPublicFor(recipientID, isOnline),
+			},
+		})
+	}
+}
+
+// UpdateProfile updates the current user's name and bio, and can reset their avatar
+func UpdateProfile(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req UpdateProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Name must be between 1 and 50 characters",
+			})
+		}
+		user.Name = name
+	}
+
+	if req.Bio != nil {
+		bio := strings.TrimSpace(*req.Bio)
+		if utf8.RuneCountInString(bio) > maxBioLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Bio must be at most 160 characters",
+			})
+		}
+		user.Bio = bio
+	}
+
+	oldMedia := user.AvatarMedia
+	// Avatars are hosted here, so other sites can't track who views a profile
+	if req.Avatar != nil {
+		if strings.TrimSpace(*req.Avatar) != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Upload a new avatar to /api/me/avatar",
+			})
+		}
+
+		// Clearing the avatar brings back a generated identicon
+		mediaID, err := media.StoreIdenticon(media.KindAvatar, user.ID.Hex())
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update profile",
+			})
+		}
+		user.Avatar = media.URL(media.KindAvatar, mediaID, media.DefaultSize)
+		user.AvatarMedia = mediaID
+	}
+
+	if err := models.UpdateProfile(user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update profile",
+		})
+	}
+
+	if oldMedia != user.AvatarMedia {
+		media.Delete(media.KindAvatar, oldMedia)
+	}
+
+	broadcastUserUpdated(user)
+
+	return c.JSON(fiber.Map{
+		"message": "Profile updated successfully",
+		"user":    user.ToPublic(websocket.Hub.IsOnline(userID)),
+	})
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/config"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"github.com/vinneth/go-webchat/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// startSession records a new session for the user, sets the auth cookie and returns the session's CSRF token
+func startSession(c *fiber.Ctx, user *models.User, rememberMe bool) (string, error) {
+	session := &models.Session{
+		UserID:    user.ID,
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		IP:        c.IP(),
+		ExpiresAt: time.Now().Add(config.AppConfig.JWTExpiry),
+	}
+	if err := models.CreateSession(session); err != nil {
+		return "", err
+	}
+
+	token, err := middleware.GenerateToken(user.ID, user.Email, session.ID)
+	if err != nil {
+		return "", err
+	}
+
+	middleware.SetAuthCookie(c, token, rememberMe)
+
+	// Signing in during the grace period cancels a pending account deletion
+	if user.DeletionAt != nil {
+		if err := models.CancelAccountDeletion(user.ID); err != nil {
+			return "", err
+		}
+	}
+
+	return session.CSRFToken, nil
+}
+
+// GetCSRFToken returns the CSRF token of the current session
+func GetCSRFToken(c *fiber.Ctx) error {
+	session, err := models.FindSessionByID(middleware.GetSessionID(c))
+	if err != nil || session == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Session has been revoked",
+		})
+	}
+
+	csrfToken, err := models.EnsureSessionCSRFToken(session)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create CSRF token",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"csrf_token": csrfToken,
+	})
+}
+
+// GetSessions returns the user's active sessions
+func GetSessions(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	currentID := middleware.GetSessionID(c)
+
+	sessions, err := models.GetUserSessions(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch sessions",
+		})
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+
+	return c.JSON(fiber.Map{
+		"sessions": sessions,
+	})
+}
+
+// RevokeSession signs out a single session
+func RevokeSession(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	sessionID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid session ID",
+		})
+	}
+
+	revoked, err := models.RevokeSession(userID, sessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke session",
+		})
+	}
+	if !revoked {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Session not found",
+		})
+	}
+	websocket.Hub.DisconnectSession(sessionID)
+
+	// Revoking the current session is a logout
+	if sessionID == middleware.GetSessionID(c) {
+		middleware.ClearAuthCookie(c)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Session revoked successfully",
+	})
+}
+
+// RevokeOtherSessions signs out every session except the current one
+func RevokeOtherSessions(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	revoked, err := models.RevokeOtherSessions(userID, middleware.GetSessionID(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke sessions",
+		})
+	}
+	websocket.Hub.DisconnectSession(revoked...)
+
+	return c.JSON(fiber.Map{
+		"message": "Signed out of all other sessions",
+		"revoked": len(revoked),
+	})
+}
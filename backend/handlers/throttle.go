@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/config"
+	"github.com/vinneth/go-webchat/mailer"
+	"github.com/vinneth/go-webchat/models"
+)
+
+// accountThrottlePolicy limits failed logins per account
+func accountThrottlePolicy() models.ThrottlePolicy {
+	cfg := config.AppConfig
+	return models.ThrottlePolicy{
+		MaxAttempts: cfg.LoginMaxAttempts,
+		Window:      cfg.LoginAttemptWindow,
+		Lockout:     cfg.LoginLockoutDuration,
+		MaxLockout:  cfg.LoginMaxLockout,
+	}
+}
+
+// ipThrottlePolicy limits failed logins per client IP, across accounts
+func ipThrottlePolicy() models.ThrottlePolicy {
+	policy := accountThrottlePolicy()
+	policy.MaxAttempts = config.AppConfig.LoginIPMaxAttempts
+	return policy
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(c *fiber.Ctx) string {
+	return "ip:" + c.IP()
+}
+
+// tooManyAttempts responds with 429 and a Retry-After header
+func tooManyAttempts(c *fiber.Ctx, retryAfter time.Duration) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error":       "Too many failed login attempts. Please try again later.",
+		"retry_after": seconds,
+	})
+}
+
+// ipRetryAfter returns how long the client IP is still locked out
+func ipRetryAfter(c *fiber.Ctx) time.Duration {
+	retryAfter, _ := models.ThrottleRetryAfter(ipThrottleKey(c))
+	return retryAfter
+}
+
+// countLoginAttempt counts a login attempt against the IP and the account before the credentials
+// are checked, and returns how long the attempt is locked out, if at all. user is nil when no
+// account exists for the email.
+func countLoginAttempt(c *fiber.Ctx, email string, user *models.User) time.Duration {
+	ipLockout, _, _ := models.RecordThrottleHit(ipThrottleKey(c), ipThrottlePolicy())
+	if ipLockout > 0 {
+		return ipLockout
+	}
+
+	// Unknown emails are locked out the same way, so responses don't reveal which accounts exist.
+	// The IP limit keeps them from filling the collection.
+	accountLockout, tripped, _ := models.RecordThrottleHit(accountThrottleKey(email), accountThrottlePolicy())
+	if tripped && user != nil {
+		notifyAccountLocked(c, user, accountLockout)
+	}
+	return accountLockout
+}
+
+// notifyAccountLocked tells the account owner about the lockout
+func notifyAccountLocked(c *fiber.Ctx, user *models.User, lockout time.Duration) {
+	mailer.SendAsync(mailer.Message{
+		To:      user.Email,
+		Subject: "Your account has been temporarily locked",
+		Body: fmt.Sprintf("Hi %s,\n\nWe noticed several failed sign-in attempts on your account, "+
+			"the last one from IP address %s at %s.\n\n"+
+			"To protect you, sign-in has been locked for %s. If this wasn't you, "+
+			"we recommend resetting your password and enabling two-factor authentication.\n",
+			user.Name, c.IP(), time.Now().UTC().Format(time.RFC1123), lockout.Round(time.Second)),
+	})
+}
+
+// loginSucceeded clears the account's failed attempts and takes back the IP's count for this attempt
+func loginSucceeded(c *fiber.Ctx, email string) {
+	models.ResetThrottle(accountThrottleKey(email))
+	models.ForgiveThrottleHit(ipThrottleKey(c))
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/config"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+)
+
+// TwoFactorCodeRequest represents a payload carrying a TOTP or recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorVerifyRequest represents the second step of a 2FA login
+type TwoFactorVerifyRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// DisableTwoFactorRequest represents disable 2FA payload
+type DisableTwoFactorRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// VerifyTwoFactor completes a login that is waiting for a 2FA code
+func VerifyTwoFactor(c *fiber.Ctx) error {
+	var req TwoFactorVerifyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Challenge == "" || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Challenge and code are required",
+		})
+	}
+
+	// Wrong codes count as failed logins, so the IP may already be locked out
+	if retryAfter := ipRetryAfter(c); retryAfter > 0 {
+		return tooManyAttempts(c, retryAfter)
+	}
+
+	// Every code tried uses up one of the challenge's attempts
+	challenge, err := models.UseTwoFactorAttempt(req.Challenge)
+	if err != nil || challenge == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Login challenge expired, please sign in again",
+		})
+	}
+
+	user, err := models.FindUserByID(challenge.UserID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Login challenge expired, please sign in again",
+		})
+	}
+
+	if lockout := countLoginAttempt(c, user.Email, user); lockout > 0 {
+		return tooManyAttempts(c, lockout)
+	}
+
+	valid, err := models.VerifyTwoFactorCode(user, req.Code, true)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify code",
+		})
+	}
+	if !valid {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid authentication code",
+		})
+	}
+
+	models.DeleteTwoFactorChallenge(challenge.ID)
+	loginSucceeded(c, user.Email)
+
+	if user.IsSuspended() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Your account has been suspended",
+		})
+	}
+
+	// Start session and set cookie
+	csrfToken, err := startSession(c, user, challenge.RememberMe)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+
+	// Update last seen
+	models.UpdateLastSeen(user.ID)
+
+	return c.JSON(AuthResponse{
+		Message:   "Login successful",
+		User:      &models.UserPublic{ID: user.ID, UniqueID: user.UniqueID, Name: user.Name, Avatar: user.Avatar},
+		CSRFToken: csrfToken,
+	})
+}
+
+// SetupTwoFactor generates a new TOTP secret for the user to confirm
+func SetupTwoFactor(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if !user.HasPassword() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Two-factor authentication is only available for password accounts",
+		})
+	}
+
+	if user.TwoFactor.Enabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Two-factor authentication is already enabled",
+		})
+	}
+
+	secret, err := models.GenerateTOTPSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate secret",
+		})
+	}
+
+	if err := models.SetPendingTOTPSecret(userID, secret); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save secret",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"secret":           secret,
+		"provisioning_uri": models.TOTPProvisioningURI(config.AppConfig.TOTPIssuer, user.Email, secret),
+	})
+}
+
+// EnableTwoFactor confirms the pending secret with a code and turns 2FA on
+func EnableTwoFactor(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if user.TwoFactor.Enabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Two-factor authentication is already enabled",
+		})
+	}
+
+	if user.TwoFactor.PendingSecret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Start two-factor setup first",
+		})
+	}
+
+	step := models.MatchTOTP(user.TwoFactor.PendingSecret, req.Code)
+	if step < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid authentication code",
+		})
+	}
+
+	codes, hashes, err := models.GenerateRecoveryCodes()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate recovery codes",
+		})
+	}
+
+	if err := models.EnableTwoFactor(userID, user.TwoFactor.PendingSecret, step, hashes); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to enable two-factor authentication",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns 2FA off after re-checking the password and a code
+func DisableTwoFactor(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req DisableTwoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if !user.TwoFactor.Enabled {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Two-factor authentication is not enabled",
+		})
+	}
+
+	// A stolen session could otherwise guess the password and code without limit
+	if lockout := countLoginAttempt(c, user.Email, user); lockout > 0 {
+		return tooManyAttempts(c, lockout)
+	}
+
+	if !models.CheckPassword(req.Password, user.PasswordHash) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid password",
+		})
+	}
+
+	valid, err := models.VerifyTwoFactorCode(user, req.Code, true)
+	if err != nil || !valid {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid authentication code",
+		})
+	}
+
+	loginSucceeded(c, user.Email)
+
+	if err := models.DisableTwoFactor(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to disable two-factor authentication",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if !user.TwoFactor.Enabled {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Two-factor authentication is not enabled",
+		})
+	}
+
+	// Only an authenticator code may be used here, not a recovery code
+	valid, err := models.VerifyTwoFactorCode(user, req.Code, false)
+	if err != nil || !valid {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid authentication code",
+		})
+	}
+
+	codes, hashes, err := models.GenerateRecoveryCodes()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate recovery codes",
+		})
+	}
+
+	if err := models.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save recovery codes",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":        "Recovery codes regenerated",
+		"recovery_codes": codes,
+	})
+}
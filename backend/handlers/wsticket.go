@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+)
+
+// CreateWSTicket issues a one-time ticket for opening a WebSocket connection
+func CreateWSTicket(c *fiber.Ctx) error {
+	origin := c.Get(fiber.HeaderOrigin)
+	if !middleware.AllowedOrigin(origin) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Origin not allowed",
+		})
+	}
+
+	ticket, err := models.CreateWSTicket(middleware.GetUserID(c), middleware.GetSessionID(c), origin)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create ticket",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"ticket":     ticket,
+		"expires_in": int(models.WSTicketTTL.Seconds()),
+	})
+}
@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileMailer writes each message to an .eml file, for local development
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer creates a new FileMailer
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+// Send writes the message to the mail directory
+func (m *FileMailer) Send(msg Message) error {
+	data, err := formatMessage(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	recipient := strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102T150405.000000000"), recipient)
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o644)
+}
+
+// LogMailer prints each message to the server log, for local development
+type LogMailer struct {
+	from string
+}
+
+// NewLogMailer creates a new LogMailer
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+// Send logs the message
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("📧 Email from %s to %s\nSubject: %s\n\n%s", m.from, msg.To, msg.Subject, msg.Body)
+	return nil
+}
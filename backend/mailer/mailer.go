@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"log"
+
+	"github.com/vinneth/go-webchat/config"
+)
+
+// Message represents an outgoing plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Default is the mailer used by the application
+var Default Mailer
+
+// Init selects the mailer implementation from configuration
+func Init() {
+	cfg := config.AppConfig
+
+	switch cfg.MailDriver {
+	case "smtp":
+		Default = NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	case "file":
+		Default = NewFileMailer(cfg.MailDir, cfg.MailFrom)
+	default:
+		Default = NewLogMailer(cfg.MailFrom)
+	}
+
+	log.Printf("📧 Using %s mailer", cfg.MailDriver)
+}
+
+// Send delivers a message with the default mailer
+func Send(msg Message) error {
+	return Default.Send(msg)
+}
+
+// SendAsync delivers a message in the background and logs failures
+func SendAsync(msg Message) {
+	go func() {
+		if err := Send(msg); err != nil {
+			log.Printf("Failed to send email to %s: %v", msg.To, err)
+		}
+	}()
+}
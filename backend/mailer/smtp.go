@@ -0,0 +1,75 @@
+package mailer
+
+import (
+	"fmt"
+	"mime"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPMailer sends email through an SMTP server
+type SMTPMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+// NewSMTPMailer creates a new SMTPMailer
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+// Send sends a message, upgrading to TLS when the server supports it
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	data, err := formatMessage(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	// The envelope takes bare addresses; formatMessage has already checked both parse
+	fromAddr, _ := mail.ParseAddress(m.from)
+	toAddr, _ := mail.ParseAddress(msg.To)
+
+	addr := m.host + ":" + m.port
+	return smtp.SendMail(addr, auth, fromAddr.Address, []string{toAddr.Address}, data)
+}
+
+// formatMessage renders a message in RFC 5322 format. Header values are parsed or
+// encoded so that user-supplied text can't break out of its header line.
+func formatMessage(from string, msg Message) ([]byte, error) {
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address: %w", err)
+	}
+	toAddr, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient address: %w", err)
+	}
+	subject := strings.Join(strings.Fields(msg.Subject), " ")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", fromAddr)
+	fmt.Fprintf(&b, "To: %s\r\n", toAddr)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
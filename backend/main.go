@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -14,13 +15,20 @@ import (
 	"github.com/vinneth/go-webchat/config"
 	"github.com/vinneth/go-webchat/database"
 	"github.com/vinneth/go-webchat/handlers"
+	"github.com/vinneth/go-webchat/mailer"
+	"github.com/vinneth/go-webchat/media"
 	"github.com/vinneth/go-webchat/middleware"
+	"github.com/vinneth/go-webchat/models"
+	"github.com/vinneth/go-webchat/oauth"
 	ws "github.com/vinneth/go-webchat/websocket"
 )
 
 func main() {
 	// Load configuration
 	config.Load()
+	if err := models.CheckUniqueIDConfig(); err != nil {
+		log.Fatalf("Invalid unique ID configuration: %v", err)
+	}
 
 	// Connect to MongoDB
 	if err := database.Connect(); err != nil {
@@ -28,13 +36,64 @@ func main() {
 	}
 	defer database.Disconnect()
 
+	// Unique IDs duplicated before the unique index existed would stop it from being created
+	if err := models.MigrateDuplicateUniqueIDs(); err != nil {
+		log.Fatalf("Failed to migrate duplicate unique IDs: %v", err)
+	}
+	if err := database.EnsureIndexes(); err != nil {
+		log.Fatalf("Failed to create MongoDB indexes: %v", err)
+	}
+
+	// Convert data stored in older formats
+	if err := models.MigrateContactEntries(); err != nil {
+		log.Fatalf("Failed to migrate contacts: %v", err)
+	}
+	if err := models.MigrateGroupOwners(); err != nil {
+		log.Fatalf("Failed to migrate group owners: %v", err)
+	}
+	if err := models.MigrateEmailVerification(); err != nil {
+		log.Fatalf("Failed to migrate email verification: %v", err)
+	}
+	if err := models.MigrateNameSearch(); err != nil {
+		log.Fatalf("Failed to migrate name search: %v", err)
+	}
+
+	// Load token signing keys
+	if err := middleware.InitKeys(); err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+
+	// Grant the admin role to configured accounts
+	if err := models.GrantAdminByEmail(config.AppConfig.AdminEmails); err != nil {
+		log.Printf("Failed to grant admin roles: %v", err)
+	}
+
+	// Create media storage directories
+	if err := media.Init(); err != nil {
+		log.Fatalf("Failed to initialize media storage: %v", err)
+	}
+	if err := models.MigrateRemoteAvatars(); err != nil {
+		log.Fatalf("Failed to migrate avatars: %v", err)
+	}
+
+	// Initialize mailer
+	mailer.Init()
+
+	// Initialize OAuth providers
+	oauth.Init()
+
 	// Initialize WebSocket hub
 	ws.InitHub()
 
+	// Purge accounts whose deletion grace period has ended
+	go handlers.RunAccountPurger(time.Hour)
+
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
 		AppName:      "Go WebChat",
 		ErrorHandler: errorHandler,
+		// Leave room for multipart overhead around the largest allowed upload
+		BodyLimit: config.AppConfig.MaxUploadSize + 1024*1024,
 	})
 
 	// Middleware
@@ -47,7 +106,7 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     config.AppConfig.FrontendURL,
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization",
+		AllowHeaders:     "Origin,Content-Type,Accept,Authorization," + middleware.CSRFHeader,
 		AllowCredentials: true,
 	}))
 
@@ -59,6 +118,19 @@ func main() {
 		})
 	})
 
+	// Public token verification keys
+	app.Get("/.well-known/jwks.json", handlers.GetJWKS)
+
+	// Uploaded images. Every upload gets a new path, so files can be cached forever.
+	app.Static("/media", config.AppConfig.MediaDir, fiber.Static{
+		MaxAge: 365 * 24 * 60 * 60,
+		ModifyResponse: func(c *fiber.Ctx) error {
+			c.Set("Cache-Control", "public, max-age=31536000, immutable")
+			c.Set("X-Content-Type-Options", "nosniff")
+			return nil
+		},
+	})
+
 	// API routes
 	api := app.Group("/api")
 
@@ -69,34 +141,140 @@ func main() {
 	auth.Post("/logout", handlers.Logout)
 	auth.Get("/google", handlers.GoogleLogin)
 	auth.Get("/google/callback", handlers.GoogleCallback)
+	auth.Get("/providers", handlers.GetOAuthProviders)
+	auth.Get("/oauth/:provider", handlers.OAuthLogin)
+	auth.Get("/oauth/:provider/callback", handlers.OAuthCallback)
+	auth.Post("/2fa/verify", handlers.VerifyTwoFactor)
+	auth.Get("/verify-email", handlers.VerifyEmailLink)
+	auth.Post("/verify-email", handlers.VerifyEmail)
+	auth.Post("/password/forgot", handlers.ForgotPassword)
+	auth.Post("/password/reset", handlers.ResetPassword)
 
 	// Protected auth routes
 	auth.Get("/me", middleware.AuthRequired(), handlers.GetMe)
+	auth.Get("/csrf", middleware.AuthRequired(), handlers.GetCSRFToken)
 	auth.Put("/unique-id", middleware.AuthRequired(), handlers.UpdateUniqueID)
+	auth.Get("/sessions", middleware.AuthRequired(), handlers.GetSessions)
+	auth.Delete("/sessions", middleware.AuthRequired(), handlers.RevokeOtherSessions)
+	auth.Delete("/sessions/:id", middleware.AuthRequired(), handlers.RevokeSession)
+	auth.Get("/oauth/:provider/link", middleware.AuthRequired(), handlers.OAuthLink)
+	auth.Get("/identities", middleware.AuthRequired(), handlers.GetIdentities)
+	auth.Delete("/identities/:provider", middleware.AuthRequired(), handlers.UnlinkIdentity)
+	auth.Post("/verify-email/request", middleware.AuthRequired(), handlers.RequestEmailVerification)
+	auth.Post("/2fa/setup", middleware.AuthRequired(), handlers.SetupTwoFactor)
+	auth.Post("/2fa/enable", middleware.AuthRequired(), handlers.EnableTwoFactor)
+	auth.Post("/2fa/disable", middleware.AuthRequired(), handlers.DisableTwoFactor)
+	auth.Post("/2fa/recovery-codes", middleware.AuthRequired(), handlers.RegenerateRecoveryCodes)
+
+	// Account routes (protected)
+	me := api.Group("/me", middleware.AuthRequired())
+	me.Put("/profile", handlers.UpdateProfile)
+	me.Post("/avatar", handlers.UploadAvatar)
+	me.Get("/privacy", handlers.GetPrivacy)
+	me.Put("/privacy", handlers.UpdatePrivacy)
+	me.Get("/export", handlers.ExportAccount)
+	me.Delete("/", handlers.DeleteAccount)
 
 	// Contacts routes (protected)
-	contacts := api.Group("/contacts", middleware.AuthRequired())
+	contacts := api.Group("/contacts", middleware.AuthRequired(), middleware.VerifiedEmailRequired())
 	contacts.Get("/", handlers.GetContacts)
-	contacts.Post("/", handlers.AddContact)
+	contacts.Get("/requests", handlers.GetContactRequests)
+	contacts.Post("/requests", handlers.SendContactRequest)
+	contacts.Post("/requests/:id/accept", handlers.AcceptContactRequest)
+	contacts.Post("/requests/:id/decline", handlers.DeclineContactRequest)
+	contacts.Delete("/requests/:id", handlers.CancelContactRequest)
+	contacts.Put("/:id", handlers.UpdateContact)
 	contacts.Delete("/:id", handlers.RemoveContact)
 	contacts.Get("/search", handlers.SearchUserByUniqueID)
+	contacts.Get("/discover", handlers.DiscoverUsers)
+	contacts.Get("/invites", handlers.GetContactInvites)
+	contacts.Post("/invites", handlers.CreateContactInvite)
+	contacts.Delete("/invites/:id", handlers.RevokeContactInvite)
+	contacts.Get("/invites/:id/qr", handlers.GetContactInviteQRCode)
+	contacts.Get("/lists", handlers.GetContactLists)
+	contacts.Post("/lists", handlers.CreateContactList)
+	contacts.Put("/lists/:id", handlers.RenameContactList)
+	contacts.Delete("/lists/:id", handlers.DeleteContactList)
+
+	// Contact invite link routes (protected)
+	invites := api.Group("/invites", middleware.AuthRequired(), middleware.VerifiedEmailRequired())
+	invites.Get("/:token", handlers.GetInvite)
+	invites.Post("/:token/accept", handlers.AcceptInvite)
 
-	// Conversations routes (protected)
-	conversations := api.Group("/conversations", middleware.AuthRequired())
-	conversations.Get("/", handlers.GetConversations)
-	conversations.Post("/", handlers.CreateConversation)
-	conversations.Get("/:id", handlers.GetConversation)
-	conversations.Get("/:id/messages", handlers.GetMessages)
+	// Blocked users routes (protected)
+	blocks := api.Group("/blocks", middleware.AuthRequired())
+	blocks.Get("/", handlers.GetBlockedUsers)
+	blocks.Post("/", handlers.BlockUser)
+	blocks.Delete("/:id", handlers.UnblockUser)
+
+	// Conversations routes (protected; some are also open to bot API keys with the given scope)
+	conversations := api.Group("/conversations")
+	conversations.Get("/", middleware.AuthRequired(models.ScopeConversationsRead), middleware.VerifiedEmailRequired(), handlers.GetConversations)
+	conversations.Post("/", middleware.AuthRequired(), middleware.VerifiedEmailRequired(), handlers.CreateConversation)
+	conversations.Get("/:id", middleware.AuthRequired(models.ScopeConversationsRead), middleware.VerifiedEmailRequired(), handlers.GetConversation)
+	conversations.Get("/:id/messages", middleware.AuthRequired(models.ScopeMessagesRead), middleware.VerifiedEmailRequired(), handlers.GetMessages)
+	conversations.Post("/:id/messages", middleware.AuthRequired(models.ScopeMessagesWrite), middleware.VerifiedEmailRequired(), handlers.SendMessage)
+	conversations.Delete("/:id/messages/:messageId", middleware.AuthRequired(), middleware.VerifiedEmailRequired(), handlers.DeleteMessage)
+	conversations.Post("/:id/messages/:messageId/pin", middleware.AuthRequired(), middleware.VerifiedEmailRequired(), handlers.PinMessage)
+	conversations.Delete("/:id/messages/:messageId/pin", middleware.AuthRequired(), middleware.VerifiedEmailRequired(), handlers.UnpinMessage)
 
 	// Groups routes (protected)
-	groups := api.Group("/groups", middleware.AuthRequired())
+	groups := api.Group("/groups", middleware.AuthRequired(), middleware.VerifiedEmailRequired())
 	groups.Post("/", handlers.CreateGroup)
+	groups.Get("/join-requests/mine", handlers.GetMyGroupJoinRequests)
+	groups.Delete("/join-requests/:requestId", handlers.CancelGroupJoinRequest)
 	groups.Put("/:id", handlers.UpdateGroup)
+	groups.Post("/:id/icon", handlers.UploadGroupIcon)
 	groups.Post("/:id/members", handlers.AddGroupMember)
 	groups.Delete("/:id/members/:userId", handlers.RemoveGroupMember)
+	groups.Post("/:id/members/:userId/promote", handlers.PromoteGroupMember)
+	groups.Post("/:id/members/:userId/demote", handlers.DemoteGroupMember)
+	groups.Post("/:id/transfer", handlers.TransferGroupOwnership)
 	groups.Post("/:id/leave", handlers.LeaveGroup)
+	groups.Get("/:id/invites", handlers.GetGroupInvites)
+	groups.Post("/:id/invites", handlers.CreateGroupInvite)
+	groups.Delete("/:id/invites/:inviteId", handlers.RevokeGroupInvite)
+	groups.Get("/:id/join-requests", handlers.GetGroupJoinRequests)
+	groups.Post("/:id/join-requests/:requestId/approve", handlers.ApproveGroupJoinRequest)
+	groups.Post("/:id/join-requests/:requestId/reject", handlers.RejectGroupJoinRequest)
+
+	// Group invite link routes (the preview is public so links can be unfurled before signing in)
+	groupInvites := api.Group("/group-invites")
+	groupInvites.Get("/:token", handlers.GetGroupInvitePreview)
+	groupInvites.Post("/:token/join", middleware.AuthRequired(), middleware.VerifiedEmailRequired(), handlers.JoinGroupByInvite)
+
+	// Bots routes (protected)
+	bots := api.Group("/bots", middleware.AuthRequired(), middleware.VerifiedEmailRequired())
+	bots.Get("/", handlers.GetBots)
+	bots.Post("/", handlers.CreateBot)
+	bots.Delete("/:id", handlers.DeleteBot)
+	bots.Get("/:id/keys", handlers.GetBotAPIKeys)
+	bots.Post("/:id/keys", handlers.CreateBotAPIKey)
+	bots.Delete("/:id/keys/:keyId", handlers.DeleteBotAPIKey)
+
+	// End-to-end encryption key directory (protected)
+	keys := api.Group("/keys", middleware.AuthRequired(), middleware.VerifiedEmailRequired())
+	keys.Get("/devices", handlers.GetDevices)
+	keys.Put("/devices/:deviceId", handlers.RegisterDevice)
+	keys.Post("/devices/:deviceId/prekeys", handlers.UploadPreKeys)
+	keys.Delete("/devices/:deviceId", handlers.DeleteDevice)
+	keys.Get("/users/:id", handlers.GetUserKeys)
+	keys.Post("/users/:id/bundles", handlers.ClaimPreKeyBundles)
+
+	// Admin routes (protected)
+	admin := api.Group("/admin", middleware.AuthRequired(), middleware.AdminRequired())
+	admin.Get("/users", handlers.AdminListUsers)
+	admin.Get("/users/:id", handlers.AdminGetUser)
+	admin.Post("/users/:id/suspend", handlers.AdminSuspendUser)
+	admin.Post("/users/:id/unsuspend", handlers.AdminUnsuspendUser)
+	admin.Post("/users/:id/logout", handlers.AdminLogoutUser)
+	admin.Put("/users/:id/role", handlers.AdminSetUserRole)
+	admin.Get("/groups/:id", handlers.AdminGetGroup)
+	admin.Delete("/groups/:id", handlers.AdminDeleteGroup)
+	admin.Delete("/messages/:id", handlers.AdminDeleteMessage)
 
-	// WebSocket route
+	// WebSocket routes
+	api.Post("/ws/ticket", middleware.AuthRequired(), handlers.CreateWSTicket)
 	app.Use("/ws", ws.WebSocketUpgrade())
 	app.Get("/ws", websocket.New(ws.HandleWebSocket))
 
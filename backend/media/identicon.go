@@ -0,0 +1,96 @@
+package media
+
+import (
+	"crypto/sha256"
+	"image"
+	"image/color"
+	"math"
+)
+
+// identiconGrid is the number of cells per side; the pattern is mirrored around the middle column
+const identiconGrid = 5
+
+var identiconBackground = color.RGBA{240, 240, 240, 255}
+
+// identicon renders a symmetric 5x5 pattern derived from seed, in every thumbnail size
+func identicon(seed string) (map[int][]byte, error) {
+	hash := sha256.Sum256([]byte(seed))
+
+	// Which cells of the left half (including the middle column) are filled
+	var cells [identiconGrid][identiconGrid]bool
+	half := (identiconGrid + 1) / 2
+	bit := 0
+	for y := 0; y < identiconGrid; y++ {
+		for x := 0; x < half; x++ {
+			filled := hash[bit/8]&(1<<(bit%8)) != 0
+			cells[y][x] = filled
+			cells[y][identiconGrid-1-x] = filled
+			bit++
+		}
+	}
+
+	// Foreground color from the last bytes of the hash
+	hue := float64(uint16(hash[28])<<8|uint16(hash[29])) / 65535 * 360
+	saturation := 0.45 + float64(hash[30])/255*0.2
+	lightness := 0.45 + float64(hash[31])/255*0.15
+	fg := hslToRGB(hue, saturation, lightness)
+
+	thumbnails := make(map[int][]byte, len(Sizes))
+	for _, size := range Sizes {
+		img := image.NewRGBA(image.Rect(0, 0, size, size))
+
+		// Half a cell of margin on each side
+		cell := float64(size) / (identiconGrid + 1)
+		margin := cell / 2
+
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				c := identiconBackground
+				cx := int(math.Floor((float64(x) - margin) / cell))
+				cy := int(math.Floor((float64(y) - margin) / cell))
+				if cx >= 0 && cx < identiconGrid && cy >= 0 && cy < identiconGrid && cells[cy][cx] {
+					c = fg
+				}
+				img.SetRGBA(x, y, c)
+			}
+		}
+
+		encoded, err := encodePNG(img)
+		if err != nil {
+			return nil, err
+		}
+		thumbnails[size] = encoded
+	}
+
+	return thumbnails, nil
+}
+
+// hslToRGB converts a hue in degrees and saturation and lightness in [0, 1] to an opaque color
+func hslToRGB(h, s, l float64) color.RGBA {
+	chroma := (1 - math.Abs(2*l-1)) * s
+	x := chroma * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - chroma/2
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = chroma, x, 0
+	case h < 120:
+		r, g, b = x, chroma, 0
+	case h < 180:
+		r, g, b = 0, chroma, x
+	case h < 240:
+		r, g, b = 0, x, chroma
+	case h < 300:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+
+	return color.RGBA{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+		A: 255,
+	}
+}
@@ -0,0 +1,142 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	_ "image/gif" // Register decoders
+	_ "image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	// maxDimension limits the width and height of uploaded images
+	maxDimension = 8192
+	// maxPixels limits the decoded size of uploaded images, about 64 MB as RGBA
+	maxPixels = 4096 * 4096
+)
+
+// allowedTypes are the sniffed content types accepted for upload
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// processImage decodes an upload and renders square PNG thumbnails in every size.
+// Re-encoding from decoded pixels drops EXIF and all other metadata.
+func processImage(data []byte) (map[int][]byte, error) {
+	if !allowedTypes[http.DetectContentType(data)] {
+		return nil, ErrInvalidImage
+	}
+
+	// Check the dimensions before decoding the whole image
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 ||
+		cfg.Width > maxDimension || cfg.Height > maxDimension || cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrInvalidImage
+	}
+
+	decoded, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	src := toRGBA(decoded)
+	if format == "jpeg" {
+		// Apply the camera orientation, which would otherwise be lost with the EXIF data
+		src = orient(src, jpegOrientation(data))
+	}
+	src = cropSquare(src)
+
+	thumbnails := make(map[int][]byte, len(Sizes))
+	for _, size := range Sizes {
+		encoded, err := encodePNG(resize(src, size))
+		if err != nil {
+			return nil, err
+		}
+		thumbnails[size] = encoded
+	}
+
+	return thumbnails, nil
+}
+
+// toRGBA copies an image into an RGBA image with its origin at (0, 0)
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+// cropSquare crops the largest centered square out of an image
+func cropSquare(img *image.RGBA) *image.RGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w == h {
+		return img
+	}
+
+	side := w
+	if h < side {
+		side = h
+	}
+	x0, y0 := (w-side)/2, (h-side)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), img, image.Pt(x0, y0), draw.Src)
+	return dst
+}
+
+// resize scales a square image to size x size, averaging the source pixels each target pixel covers
+func resize(src *image.RGBA, size int) *image.RGBA {
+	srcSize := src.Bounds().Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for y := 0; y < size; y++ {
+		sy0, sy1 := span(y, size, srcSize)
+		for x := 0; x < size; x++ {
+			sx0, sx1 := span(x, size, srcSize)
+
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := sx0; sx < sx1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// span returns the range of source pixels covered by target pixel i, always at least one pixel wide
+func span(i, size, srcSize int) (int, int) {
+	start := i * srcSize / size
+	end := (i + 1) * srcSize / size
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
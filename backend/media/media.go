@@ -0,0 +1,113 @@
+package media
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/vinneth/go-webchat/config"
+)
+
+// Kinds of stored images, each in its own directory
+const (
+	KindAvatar    = "avatars"
+	KindGroupIcon = "group-icons"
+)
+
+// Sizes are the edge lengths, in pixels, of the square thumbnails generated for every image
+var Sizes = []int{64, 128, 256, 512}
+
+// DefaultSize is the thumbnail size stored as the avatar or group icon URL
+const DefaultSize = 256
+
+// ErrInvalidImage is returned for uploads that are not a supported, reasonably sized image
+var ErrInvalidImage = errors.New("upload is not a supported image")
+
+var mediaIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Init creates the storage directories
+func Init() error {
+	for _, kind := range []string{KindAvatar, KindGroupIcon} {
+		if err := os.MkdirAll(filepath.Join(config.AppConfig.MediaDir, kind), 0o755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newID generates a random media ID. Every upload gets a new ID, so stored files never change
+// and can be cached forever.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// URL returns the public URL of one thumbnail of a stored image
+func URL(kind, id string, size int) string {
+	return fmt.Sprintf("%s/media/%s/%s/%d.png", config.AppConfig.APIURL, kind, id, size)
+}
+
+// URLs returns the public URLs of every thumbnail of a stored image, keyed by size
+func URLs(kind, id string) map[string]string {
+	urls := make(map[string]string, len(Sizes))
+	for _, size := range Sizes {
+		urls[strconv.Itoa(size)] = URL(kind, id, size)
+	}
+	return urls
+}
+
+// store writes the encoded thumbnails of an image under a new media ID
+func store(kind string, thumbnails map[int][]byte) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(config.AppConfig.MediaDir, kind, id)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	for size, data := range thumbnails {
+		if err := os.WriteFile(filepath.Join(dir, strconv.Itoa(size)+".png"), data, 0o644); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+
+	return id, nil
+}
+
+// StoreImage validates an uploaded image, generates its thumbnails and stores them, returning the media ID
+func StoreImage(kind string, data []byte) (string, error) {
+	thumbnails, err := processImage(data)
+	if err != nil {
+		return "", err
+	}
+	return store(kind, thumbnails)
+}
+
+// StoreIdenticon renders an identicon for seed and stores it, returning the media ID
+func StoreIdenticon(kind, seed string) (string, error) {
+	thumbnails, err := identicon(seed)
+	if err != nil {
+		return "", err
+	}
+	return store(kind, thumbnails)
+}
+
+// Delete removes every thumbnail of a stored image
+func Delete(kind, id string) error {
+	if !mediaIDPattern.MatchString(id) {
+		return nil
+	}
+	return os.RemoveAll(filepath.Join(config.AppConfig.MediaDir, kind, id))
+}
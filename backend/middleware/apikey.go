@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidAPIKey is returned when an API key is unknown or revoked
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// AuthenticateAPIKey looks up a bot API key
+func AuthenticateAPIKey(token string) (*models.APIKey, error) {
+	key, err := models.FindAPIKey(token)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	bot, err := models.FindUserByID(key.BotID)
+	if err != nil {
+		return nil, err
+	}
+	if bot == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if bot.IsSuspended() {
+		return nil, ErrAccountSuspended
+	}
+
+	// Record key activity
+	models.TouchAPIKey(key)
+
+	return key, nil
+}
+
+// authenticateAPIKeyRequest handles AuthRequired for requests made with an API key
+func authenticateAPIKeyRequest(c *fiber.Ctx, token string, scopes []string) error {
+	if len(scopes) == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "API keys cannot access this endpoint",
+		})
+	}
+
+	key, err := AuthenticateAPIKey(token)
+	if err == ErrAccountSuspended {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "This bot has been suspended",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid API key",
+		})
+	}
+
+	for _, scope := range scopes {
+		if !key.HasScope(scope) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "API key is missing the " + scope + " scope",
+			})
+		}
+	}
+
+	// Set bot info in context
+	c.Locals("userID", key.BotID)
+	c.Locals("apiKey", key)
+
+	return c.Next()
+}
+
+// GetAPIKey gets the API key the request was authenticated with, if any
+func GetAPIKey(c *fiber.Ctx) *models.APIKey {
+	key, _ := c.Locals("apiKey").(*models.APIKey)
+	return key
+}
+
+// CanAccessConversation reports whether the request's credentials may be used in a conversation.
+// Membership is checked separately; this only applies the conversation limits of API keys.
+func CanAccessConversation(c *fiber.Ctx, convID primitive.ObjectID) bool {
+	key := GetAPIKey(c)
+	return key == nil || key.AllowsConversation(convID)
+}
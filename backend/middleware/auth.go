@@ -1,41 +1,55 @@
 package middleware
 
 import (
+	"errors"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/vinneth/go-webchat/config"
+	"github.com/vinneth/go-webchat/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	// ErrSessionRevoked is returned when a token's session no longer exists
+	ErrSessionRevoked = errors.New("session has been revoked")
+	// ErrAccountSuspended is returned when the account has been suspended by an admin
+	ErrAccountSuspended = errors.New("account has been suspended")
+)
+
+// SessionAudience is the aud claim of session tokens
+const SessionAudience = "go-webchat"
+
 type JWTClaims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a JWT token for a user
-func GenerateToken(userID primitive.ObjectID, email string) (string, error) {
+// GenerateToken generates a JWT token for a user session
+func GenerateToken(userID primitive.ObjectID, email string, sessionID primitive.ObjectID) (string, error) {
 	claims := JWTClaims{
-		UserID: userID.Hex(),
-		Email:  email,
+		UserID:    userID.Hex(),
+		Email:     email,
+		SessionID: sessionID.Hex(),
 		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    TokenIssuer(),
+			Subject:   userID.Hex(),
+			Audience:  jwt.ClaimStrings{SessionAudience},
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.AppConfig.JWTExpiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.AppConfig.JWTSecret))
+	return signToken(claims)
 }
 
 // ValidateToken validates a JWT token and returns claims
 func ValidateToken(tokenString string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.AppConfig.JWTSecret), nil
-	})
+	token, err := parseToken(tokenString, &JWTClaims{}, SessionAudience)
 
 	if err != nil {
 		return nil, err
@@ -48,29 +62,86 @@ func ValidateToken(tokenString string) (*JWTClaims, error) {
 	return nil, jwt.ErrSignatureInvalid
 }
 
-// AuthRequired middleware checks for valid JWT token
-func AuthRequired() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		var tokenString string
+// Authenticate validates a JWT token and checks that its session is still active
+func Authenticate(tokenString string) (*JWTClaims, *models.Session, error) {
+	claims, err := ValidateToken(tokenString)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		// Try to get token from cookie first
-		tokenString = c.Cookies("auth_token")
+	sessionID, err := primitive.ObjectIDFromHex(claims.SessionID)
+	if err != nil {
+		return nil, nil, ErrSessionRevoked
+	}
 
-		// Fallback to Authorization header
-		if tokenString == "" {
-			authHeader := c.Get("Authorization")
-			if strings.HasPrefix(authHeader, "Bearer ") {
-				tokenString = strings.TrimPrefix(authHeader, "Bearer ")
-			}
-		}
+	session, err := models.FindSessionByID(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if session == nil || session.UserID != userID {
+		return nil, nil, ErrSessionRevoked
+	}
+
+	user, err := models.FindUserByID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil {
+		return nil, nil, ErrSessionRevoked
+	}
+	if user.IsSuspended() {
+		return nil, nil, ErrAccountSuspended
+	}
+
+	return claims, session, nil
+}
+
+// TokenFromRequest extracts the JWT from the auth cookie or Authorization header
+func TokenFromRequest(c *fiber.Ctx) string {
+	// Try to get token from cookie first
+	if tokenString := c.Cookies("auth_token"); tokenString != "" {
+		return tokenString
+	}
+
+	// Fallback to Authorization header
+	authHeader := c.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		return strings.TrimPrefix(authHeader, "Bearer ")
+	}
+	return ""
+}
 
+// AuthRequired middleware checks for valid JWT token.
+// Bot API keys are only accepted when scopes are given, and must hold all of them.
+func AuthRequired(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenString := TokenFromRequest(c)
 		if tokenString == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Authentication required",
 			})
 		}
 
-		claims, err := ValidateToken(tokenString)
+		if models.IsAPIKey(tokenString) {
+			return authenticateAPIKeyRequest(c, tokenString, scopes)
+		}
+
+		claims, session, err := Authenticate(tokenString)
+		if err == ErrSessionRevoked {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Session has been revoked",
+			})
+		}
+		if err == ErrAccountSuspended {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Your account has been suspended",
+			})
+		}
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Invalid or expired token",
@@ -85,9 +156,67 @@ func AuthRequired() fiber.Handler {
 			})
 		}
 
+		// Browsers send the cookie automatically, so cookie requests must also prove they came from the frontend.
+		// Bearer tokens are never attached by the browser and need no CSRF token.
+		if c.Cookies("auth_token") == tokenString && !ValidCSRF(c, session) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Invalid or missing CSRF token",
+			})
+		}
+
+		// Record session activity
+		models.TouchSession(session)
+
 		// Set user info in context
 		c.Locals("userID", userID)
 		c.Locals("email", claims.Email)
+		c.Locals("sessionID", session.ID)
+
+		return c.Next()
+	}
+}
+
+// VerifiedEmailRequired rejects users with an unverified email when verification is enforced
+func VerifiedEmailRequired() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Bots have no email address
+		if !config.AppConfig.RequireEmailVerification || GetAPIKey(c) != nil {
+			return c.Next()
+		}
+
+		user, err := models.FindUserByID(GetUserID(c))
+		if err != nil || user == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Authentication required",
+			})
+		}
+
+		if !user.EmailVerified {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Please verify your email address first",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// AdminRequired rejects users who are not server administrators; use after AuthRequired
+func AdminRequired() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Bots are never administrators
+		if GetAPIKey(c) != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Admin access required",
+			})
+		}
+
+		user, err := models.FindUserByID(GetUserID(c))
+		if err != nil || user == nil || !user.IsAdmin() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Admin access required",
+			})
+		}
 
 		return c.Next()
 	}
@@ -102,6 +231,15 @@ func GetUserID(c *fiber.Ctx) primitive.ObjectID {
 	return userID
 }
 
+// GetSessionID gets the authenticated session ID from context
+func GetSessionID(c *fiber.Ctx) primitive.ObjectID {
+	sessionID, ok := c.Locals("sessionID").(primitive.ObjectID)
+	if !ok {
+		return primitive.NilObjectID
+	}
+	return sessionID
+}
+
 // SetAuthCookie sets the HTTP-only auth cookie
 func SetAuthCookie(c *fiber.Ctx, token string, rememberMe bool) {
 	maxAge := 24 * 60 * 60 // 24 hours
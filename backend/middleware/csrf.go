@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/vinneth/go-webchat/models"
+)
+
+// CSRFHeader carries the session's CSRF token on unsafe cookie-authenticated requests
+const CSRFHeader = "X-CSRF-Token"
+
+// ValidCSRF checks the CSRF token of a request authenticated by the session cookie
+func ValidCSRF(c *fiber.Ctx, session *models.Session) bool {
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return true
+	}
+
+	token := c.Get(CSRFHeader)
+	return token != "" && session.CSRFToken != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRFToken)) == 1
+}
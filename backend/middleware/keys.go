@@ -0,0 +1,270 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vinneth/go-webchat/config"
+)
+
+// jwtKey is a key used to sign or verify tokens
+type jwtKey struct {
+	id     string
+	method jwt.SigningMethod
+	sign   interface{} // nil for verification-only keys
+	verify interface{}
+}
+
+var (
+	signingKey       *jwtKey
+	verificationKeys = map[string]*jwtKey{}
+)
+
+// InitKeys loads the signing key and the keys accepted for verification
+func InitKeys() error {
+	cfg := config.AppConfig
+	signingKey = nil
+	verificationKeys = map[string]*jwtKey{}
+
+	switch cfg.JWTAlgorithm {
+	case "HS256":
+		if cfg.Env == "production" && cfg.JWTSecret == config.DefaultJWTSecret {
+			return errors.New("JWT_SECRET must be set in production")
+		}
+		signingKey = hmacKey(cfg.JWTSecret)
+
+	case "RS256", "EdDSA":
+		var err error
+		if cfg.JWTPrivateKeyFile != "" {
+			signingKey, err = loadKeyFile(cfg.JWTPrivateKeyFile)
+		} else if cfg.Env == "production" {
+			err = errors.New("JWT_PRIVATE_KEY_FILE must be set in production")
+		} else {
+			log.Printf("⚠️  No JWT_PRIVATE_KEY_FILE set, generating a temporary %s key", cfg.JWTAlgorithm)
+			signingKey, err = generateKey(cfg.JWTAlgorithm)
+		}
+		if err != nil {
+			return err
+		}
+		if signingKey.sign == nil || signingKey.method.Alg() != cfg.JWTAlgorithm {
+			return fmt.Errorf("JWT_PRIVATE_KEY_FILE must hold a %s private key", cfg.JWTAlgorithm)
+		}
+
+	default:
+		return fmt.Errorf("unsupported JWT_ALGORITHM %q", cfg.JWTAlgorithm)
+	}
+
+	verificationKeys[signingKey.id] = signingKey
+
+	// Retired keys stay valid for verification so rotation doesn't sign everyone out
+	for _, path := range cfg.JWTVerificationKeyFiles {
+		key, err := loadKeyFile(path)
+		if err != nil {
+			return err
+		}
+		verificationKeys[key.id] = key
+	}
+
+	if signingKey.id != "" {
+		log.Printf("🔐 Signing tokens with %s key %s", signingKey.method.Alg(), signingKey.id)
+	}
+	return nil
+}
+
+// hmacKey wraps the shared secret; HMAC tokens carry no kid
+func hmacKey(secret string) *jwtKey {
+	return &jwtKey{
+		id:     "",
+		method: jwt.SigningMethodHS256,
+		sign:   []byte(secret),
+		verify: []byte(secret),
+	}
+}
+
+// generateKey creates a temporary key pair for development
+func generateKey(alg string) (*jwtKey, error) {
+	if alg == "EdDSA" {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return newAsymmetricKey(private)
+	}
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return newAsymmetricKey(private)
+}
+
+// loadKeyFile reads a PEM encoded RSA or Ed25519 private or public key
+func loadKeyFile(path string) (*jwtKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key, err := newAsymmetricKey(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// newAsymmetricKey builds a key from a parsed RSA or Ed25519 key, identified by its JWK thumbprint
+func newAsymmetricKey(parsed interface{}) (*jwtKey, error) {
+	key := &jwtKey{}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.sign, key.verify = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.verify = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.method, key.sign, key.verify = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.method, key.verify = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	jwk := publicJWK(key)
+	thumbprint, err := jwkThumbprint(jwk)
+	if err != nil {
+		return nil, err
+	}
+	key.id = thumbprint
+	return key, nil
+}
+
+// publicJWK describes a verification key as a JSON Web Key (RFC 7517)
+func publicJWK(key *jwtKey) map[string]string {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch public := key.verify.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"n":   encode(public.N.Bytes()),
+			"e":   encode(big.NewInt(int64(public.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   encode(public),
+		}
+	}
+	return nil
+}
+
+// jwkThumbprint computes the RFC 7638 SHA-256 thumbprint of a JWK
+func jwkThumbprint(jwk map[string]string) (string, error) {
+	if jwk == nil {
+		return "", errors.New("key has no JWK representation")
+	}
+
+	// Required members only, in lexicographic order (json.Marshal sorts map keys)
+	required := map[string]string{"kty": jwk["kty"]}
+	for _, member := range []string{"crv", "e", "n", "x"} {
+		if value, ok := jwk[member]; ok {
+			required[member] = value
+		}
+	}
+
+	data, err := json.Marshal(required)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// TokenIssuer is the iss claim of every token this server signs
+func TokenIssuer() string {
+	return config.AppConfig.APIURL
+}
+
+// signToken signs claims with the current signing key
+func signToken(claims jwt.Claims) (string, error) {
+	if signingKey == nil {
+		return "", errors.New("signing key not initialized")
+	}
+
+	token := jwt.NewWithClaims(signingKey.method, claims)
+	if signingKey.id != "" {
+		token.Header["kid"] = signingKey.id
+	}
+	return token.SignedString(signingKey.sign)
+}
+
+// parseToken verifies a token against the key named by its kid header, along with its issuer and audience
+func parseToken(tokenString string, claims jwt.Claims, audience string) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := verificationKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		// Each key is only valid with its own algorithm
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, jwt.ErrTokenSignatureInvalid
+		}
+		return key.verify, nil
+	},
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}),
+		jwt.WithIssuer(TokenIssuer()),
+		jwt.WithAudience(audience),
+	)
+}
+
+// PublicJWKS returns the public verification keys as a JWK Set
+func PublicJWKS() map[string]interface{} {
+	keys := []map[string]string{}
+	for _, key := range verificationKeys {
+		jwk := publicJWK(key)
+		if jwk == nil {
+			// Symmetric keys are never published
+			continue
+		}
+		jwk["kid"] = key.id
+		jwk["alg"] = key.method.Alg()
+		jwk["use"] = "sig"
+		keys = append(keys, jwk)
+	}
+
+	return map[string]interface{}{"keys": keys}
+}
@@ -0,0 +1,12 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/vinneth/go-webchat/config"
+)
+
+// AllowedOrigin reports whether an Origin header belongs to the frontend
+func AllowedOrigin(origin string) bool {
+	return origin != "" && origin == strings.TrimSuffix(config.AppConfig.FrontendURL, "/")
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DeletedUserName replaces the name of deleted accounts
+const DeletedUserName = "Deleted account"
+
+// ScheduleAccountDeletion marks an account to be deleted at the given time
+func ScheduleAccountDeletion(userID primitive.ObjectID, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"deletion_at": at}},
+	)
+	return err
+}
+
+// CancelAccountDeletion cancels a scheduled account deletion
+func CancelAccountDeletion(userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$unset": bson.M{"deletion_at": ""}},
+	)
+	return err
+}
+
+// GetAccountsDueForDeletion gets accounts whose deletion grace period has ended
+func GetAccountsDueForDeletion() ([]User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := database.Users.Find(ctx, bson.M{
+		"deletion_at": bson.M{"$lte": time.Now()},
+		"deleted":     bson.M{"$ne": true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// RemoveFromAllContacts removes a user from every other user's contact list
+func RemoveFromAllContacts(userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateMany(
+		ctx,
+		bson.M{"contacts.user_id": userID},
+		bson.M{"$pull": bson.M{"contacts": bson.M{"user_id": userID}}},
+	)
+	return err
+}
+
+// AnonymizeUser strips a deleted account of its personal data and sign-in methods.
+// The document is kept so that messages sent by the user still resolve to a sender.
+func AnonymizeUser(userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{
+			"$set": bson.M{
+				"deleted":        true,
+				"name":           DeletedUserName,
+				"avatar":         "",
+				"unique_id":      "#DELETED-" + userID.Hex(),
+				"email_verified": false,
+				"contacts":       []ContactEntry{},
+			},
+			"$unset": bson.M{
+				"email":         "",
+				"name_search":   "",
+				"password_hash": "",
+				"identities":    "",
+				"two_factor":    "",
+				"deletion_at":   "",
+				"contact_lists": "",
+			},
+		},
+	)
+	return err
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RoleAdmin is the server-wide administrator role
+const RoleAdmin = "admin"
+
+// Suspension records why and by whom an account was suspended
+type Suspension struct {
+	Reason      string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	SuspendedBy primitive.ObjectID `bson:"suspended_by" json:"suspended_by"`
+	SuspendedAt time.Time          `bson:"suspended_at" json:"suspended_at"`
+}
+
+// IsAdmin reports whether the user is a server administrator
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// IsSuspended reports whether the account is suspended
+func (u *User) IsSuspended() bool {
+	return u.Suspension != nil
+}
+
+// GrantAdminByEmail gives the admin role to the accounts with the given emails
+func GrantAdminByEmail(emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateMany(
+		ctx,
+		bson.M{"email": bson.M{"$in": emails}},
+		bson.M{"$set": bson.M{"role": RoleAdmin}},
+	)
+	return err
+}
+
+// SetUserRole sets or clears a user's server-wide role
+func SetUserRole(userID primitive.ObjectID, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"role": role}}
+	if role == "" {
+		update = bson.M{"$unset": bson.M{"role": ""}}
+	}
+
+	_, err := database.Users.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	return err
+}
+
+// SuspendUser suspends an account
+func SuspendUser(userID, adminID primitive.ObjectID, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"suspension": Suspension{
+			Reason:      reason,
+			SuspendedBy: adminID,
+			SuspendedAt: time.Now(),
+		}}},
+	)
+	return err
+}
+
+// UnsuspendUser lifts an account's suspension
+func UnsuspendUser(userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$unset": bson.M{"suspension": ""}},
+	)
+	return err
+}
+
+// SearchUsers finds users whose name, email or unique ID contains the query, newest first
+func SearchUsers(query string, suspendedOnly bool, skip, limit int64) ([]User, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if query != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(query), Options: "i"}
+		filter["$or"] = bson.A{
+			bson.M{"name": pattern},
+			bson.M{"email": pattern},
+			bson.M{"unique_id": pattern},
+		}
+	}
+	if suspendedOnly {
+		filter["suspension"] = bson.M{"$exists": true}
+	}
+
+	total, err := database.Users.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.M{"created_at": -1}).
+		SetSkip(skip).
+		SetLimit(limit)
+
+	cursor, err := database.Users.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APIKeyPrefix marks a bearer token as a bot API key rather than a JWT
+const APIKeyPrefix = "wcb_"
+
+// API key scopes
+const (
+	ScopeMessagesRead      = "messages:read"
+	ScopeMessagesWrite     = "messages:write"
+	ScopeConversationsRead = "conversations:read"
+)
+
+// APIKeyScopes lists every scope an API key can be granted
+var APIKeyScopes = []string{ScopeMessagesRead, ScopeMessagesWrite, ScopeConversationsRead}
+
+// apiKeyTouchInterval limits how often last_used_at is written
+const apiKeyTouchInterval = time.Minute
+
+// APIKey is a long-lived credential for a bot, limited to scopes and conversations
+type APIKey struct {
+	ID              primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	BotID           primitive.ObjectID   `bson:"bot_id" json:"bot_id"`
+	Name            string               `bson:"name" json:"name"`
+	Hint            string               `bson:"hint" json:"hint"` // Leading characters of the key, for display
+	KeyHash         string               `bson:"key_hash" json:"-"`
+	Scopes          []string             `bson:"scopes" json:"scopes"`
+	ConversationIDs []primitive.ObjectID `bson:"conversation_ids" json:"conversation_ids"`
+	CreatedAt       time.Time            `bson:"created_at" json:"created_at"`
+	LastUsedAt      *time.Time           `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+}
+
+// IsAPIKey reports whether a bearer token looks like an API key
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// ValidScope reports whether scope is a known API key scope
+func ValidScope(scope string) bool {
+	for _, s := range APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the key was granted a scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsConversation reports whether the key may be used in a conversation
+func (k *APIKey) AllowsConversation(convID primitive.ObjectID) bool {
+	for _, id := range k.ConversationIDs {
+		if id == convID {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKey stores a new key and returns its plaintext value, which is only available now
+func CreateAPIKey(key *APIKey) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	secret, err := NewRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	token := APIKeyPrefix + secret
+
+	key.KeyHash = HashToken(token)
+	key.Hint = token[:len(APIKeyPrefix)+6]
+	key.CreatedAt = time.Now()
+
+	result, err := database.APIKeys.InsertOne(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	key.ID = result.InsertedID.(primitive.ObjectID)
+	return token, nil
+}
+
+// FindAPIKey finds the key matching a plaintext API key
+func FindAPIKey(token string) (*APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var key APIKey
+	err := database.APIKeys.FindOne(ctx, bson.M{"key_hash": HashToken(token)}).Decode(&key)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetBotAPIKeys gets all keys of a bot, newest first
+func GetBotAPIKeys(botID primitive.ObjectID) ([]APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := database.APIKeys.Find(ctx, bson.M{"bot_id": botID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// TouchAPIKey updates the key's last used timestamp, at most once per interval
+func TouchAPIKey(key *APIKey) error {
+	if key.LastUsedAt != nil && time.Since(*key.LastUsedAt) < apiKeyTouchInterval {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.APIKeys.UpdateOne(
+		ctx,
+		bson.M{"_id": key.ID},
+		bson.M{"$set": bson.M{"last_used_at": time.Now()}},
+	)
+	return err
+}
+
+// DeleteAPIKey revokes a single key of a bot
+func DeleteAPIKey(botID, keyID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.APIKeys.DeleteOne(ctx, bson.M{
+		"_id":    keyID,
+		"bot_id": botID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrBlocked is returned when a message can't be delivered because one side blocked the other
+var ErrBlocked = errors.New("you can't message this user")
+
+// HasBlocked reports whether the user has blocked another user
+func (u *User) HasBlocked(userID primitive.ObjectID) bool {
+	for _, id := range u.Blocked {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// BlockUser adds a user to the blocklist and removes them from each other's contacts
+func BlockUser(userID, blockedID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{
+			"$addToSet": bson.M{"blocked": blockedID},
+			"$pull":     bson.M{"contacts": bson.M{"user_id": blockedID}},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": blockedID},
+		bson.M{"$pull": bson.M{"contacts": bson.M{"user_id": userID}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Drop pending contact requests in either direction
+	_, err = database.ContactRequests.DeleteMany(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"from_id": userID, "to_id": blockedID},
+			bson.M{"from_id": blockedID, "to_id": userID},
+		},
+	})
+	return err
+}
+
+// UnblockUser removes a user from the blocklist
+func UnblockUser(userID, blockedID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$pull": bson.M{"blocked": blockedID}},
+	)
+	return err
+}
+
+// GetBlockedUsers gets the users a user has blocked
+func GetBlockedUsers(userID primitive.ObjectID) ([]User, error) {
+	user, err := FindUserByID(userID)
+	if err != nil || user == nil {
+		return nil, err
+	}
+
+	if len(user.Blocked) == 0 {
+		return []User{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := database.Users.Find(ctx, bson.M{"_id": bson.M{"$in": user.Blocked}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// IsBlockedBetween reports whether either user has blocked the other
+func IsBlockedBetween(user1ID, user2ID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := database.Users.CountDocuments(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"_id": user1ID, "blocked": user2ID},
+			bson.M{"_id": user2ID, "blocked": user1ID},
+		},
+	})
+	return count > 0, err
+}
+
+// GetBlockersAmong returns which of the given users have blocked userID
+func GetBlockersAmong(userID primitive.ObjectID, candidates []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := database.Users.Find(ctx, bson.M{
+		"_id":     bson.M{"$in": candidates},
+		"blocked": userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	blockers := make([]primitive.ObjectID, 0, len(users))
+	for _, user := range users {
+		blockers = append(blockers, user.ID)
+	}
+	return blockers, nil
+}
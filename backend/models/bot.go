@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateBot creates a bot user owned by a human user
+func CreateBot(ownerID primitive.ObjectID, name, avatar string) (*User, error) {
+	bot := &User{
+		Name:         name,
+		Avatar:       avatar,
+		AuthProvider: "bot",
+		IsBot:        true,
+		BotOwnerID:   ownerID,
+	}
+
+	if err := CreateUser(bot); err != nil {
+		return nil, err
+	}
+	return bot, nil
+}
+
+// FindOwnedBot finds a bot by ID if it belongs to the owner
+func FindOwnedBot(ownerID, botID primitive.ObjectID) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var bot User
+	err := database.Users.FindOne(ctx, bson.M{
+		"_id":          botID,
+		"is_bot":       true,
+		"bot_owner_id": ownerID,
+	}).Decode(&bot)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &bot, nil
+}
+
+// GetOwnedBots gets all bots owned by a user
+func GetOwnedBots(ownerID primitive.ObjectID) ([]User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": 1})
+	cursor, err := database.Users.Find(ctx, bson.M{"is_bot": true, "bot_owner_id": ownerID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	bots := []User{}
+	if err := cursor.All(ctx, &bots); err != nil {
+		return nil, err
+	}
+
+	return bots, nil
+}
+
+// DeleteBot deletes a bot, its API keys and its group memberships
+func DeleteBot(botID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := database.APIKeys.DeleteMany(ctx, bson.M{"bot_id": botID}); err != nil {
+		return err
+	}
+
+	_, err := database.Conversations.UpdateMany(
+		ctx,
+		bson.M{"members": botID},
+		bson.M{"$pull": bson.M{"members": botID}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Users.DeleteOne(ctx, bson.M{"_id": botID, "is_bot": true})
+	return err
+}
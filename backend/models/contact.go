@@ -0,0 +1,200 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MaxContactLists limits how many contact lists a user can define
+const MaxContactLists = 20
+
+// ErrTooManyContactLists is returned when a user already has MaxContactLists lists
+var ErrTooManyContactLists = errors.New("too many contact lists")
+
+// ContactEntry is a user in someone's contact list, with annotations only the owner can see
+type ContactEntry struct {
+	UserID   primitive.ObjectID   `bson:"user_id" json:"user_id"`
+	Nickname string               `bson:"nickname,omitempty" json:"nickname,omitempty"`
+	Note     string               `bson:"note,omitempty" json:"note,omitempty"`
+	Favorite bool                 `bson:"favorite,omitempty" json:"favorite"`
+	Lists    []primitive.ObjectID `bson:"lists,omitempty" json:"lists"` // IDs of the owner's ContactLists
+	AddedAt  time.Time            `bson:"added_at" json:"added_at"`
+}
+
+// ContactList is a user-defined group of contacts, like "Team" or "Family"
+type ContactList struct {
+	ID   primitive.ObjectID `bson:"_id" json:"id"`
+	Name string             `bson:"name" json:"name"`
+}
+
+// ContactEntryUpdate holds the annotations to change on a contact; nil fields are left unchanged
+type ContactEntryUpdate struct {
+	Nickname *string
+	Note     *string
+	Favorite *bool
+	Lists    []primitive.ObjectID // Replaces the list memberships when not nil
+}
+
+// FindContact returns the user's entry for a contact, or nil if they are not a contact
+func (u *User) FindContact(userID primitive.ObjectID) *ContactEntry {
+	for i := range u.Contacts {
+		if u.Contacts[i].UserID == userID {
+			return &u.Contacts[i]
+		}
+	}
+	return nil
+}
+
+// ContactIDs returns the IDs of the user's contacts
+func (u *User) ContactIDs() []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, 0, len(u.Contacts))
+	for _, entry := range u.Contacts {
+		ids = append(ids, entry.UserID)
+	}
+	return ids
+}
+
+// FindContactList returns one of the user's contact lists, or nil if there is none with the ID
+func (u *User) FindContactList(listID primitive.ObjectID) *ContactList {
+	for i := range u.ContactLists {
+		if u.ContactLists[i].ID == listID {
+			return &u.ContactLists[i]
+		}
+	}
+	return nil
+}
+
+// UpdateContactEntry changes the annotations of one of a user's contacts,
+// reporting false if they are not a contact
+func UpdateContactEntry(userID, contactID primitive.ObjectID, update ContactEntryUpdate) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	set := bson.M{}
+	if update.Nickname != nil {
+		set["contacts.$.nickname"] = *update.Nickname
+	}
+	if update.Note != nil {
+		set["contacts.$.note"] = *update.Note
+	}
+	if update.Favorite != nil {
+		set["contacts.$.favorite"] = *update.Favorite
+	}
+	if update.Lists != nil {
+		set["contacts.$.lists"] = update.Lists
+	}
+	if len(set) == 0 {
+		return true, nil
+	}
+
+	result, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID, "contacts.user_id": contactID},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// CreateContactList adds a contact list for a user
+func CreateContactList(userID primitive.ObjectID, name string) (*ContactList, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	list := &ContactList{ID: primitive.NewObjectID(), Name: name}
+
+	// The size check and the push are one update, so the limit holds under concurrency
+	result, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{
+			"_id": userID,
+			"contact_lists." + strconv.Itoa(MaxContactLists-1): bson.M{"$exists": false},
+		},
+		bson.M{"$push": bson.M{"contact_lists": list}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrTooManyContactLists
+	}
+	return list, nil
+}
+
+// RenameContactList renames one of a user's contact lists, reporting false if it doesn't exist
+func RenameContactList(userID, listID primitive.ObjectID, name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID, "contact_lists._id": listID},
+		bson.M{"$set": bson.M{"contact_lists.$.name": name}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// DeleteContactList deletes one of a user's contact lists and removes every contact from it
+func DeleteContactList(userID, listID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID, "contact_lists._id": listID},
+		bson.M{"$pull": bson.M{
+			"contact_lists":      bson.M{"_id": listID},
+			"contacts.$[].lists": listID,
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// MigrateContactEntries converts contact lists stored as plain user IDs, from before contacts
+// had annotations, into contact entries. It is safe to run on every start.
+func MigrateContactEntries() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	result, err := database.Users.UpdateMany(
+		ctx,
+		bson.M{"contacts": bson.M{"$type": "objectId"}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"contacts": bson.M{"$map": bson.M{
+					"input": "$contacts",
+					"as":    "contact",
+					"in": bson.M{"$cond": bson.A{
+						bson.M{"$eq": bson.A{bson.M{"$type": "$$contact"}, "objectId"}},
+						// When the contact was added isn't known; use the time of the migration
+						bson.M{"user_id": "$$contact", "added_at": "$$NOW"},
+						"$$contact",
+					}},
+				}},
+			}}},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Migrated the contacts of %d users to contact entries", result.ModifiedCount)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxContactInvitesPerUser limits how many invite links a user can have at once
+const MaxContactInvitesPerUser = 20
+
+// ContactInvite is a shareable link that lets anyone holding it send the owner a contact request,
+// even when the owner can't otherwise be discovered
+type ContactInvite struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Token     string             `bson:"token" json:"token"`
+	MaxUses   int                `bson:"max_uses,omitempty" json:"max_uses,omitempty"` // Zero for unlimited
+	Uses      int                `bson:"uses" json:"uses"`
+	ExpiresAt *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// usableInviteFilter matches invites that have not expired or run out of uses
+func usableInviteFilter(filter bson.M) bson.M {
+	filter["$and"] = bson.A{
+		bson.M{"$or": bson.A{
+			bson.M{"expires_at": bson.M{"$exists": false}},
+			bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+		}},
+		bson.M{"$or": bson.A{
+			bson.M{"max_uses": bson.M{"$exists": false}},
+			bson.M{"$expr": bson.M{"$lt": bson.A{"$uses", "$max_uses"}}},
+		}},
+	}
+	return filter
+}
+
+// CreateContactInvite creates an invite link for a user
+func CreateContactInvite(userID primitive.ObjectID, maxUses int, expiresAt *time.Time) (*ContactInvite, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token, err := NewRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	invite := &ContactInvite{
+		UserID:    userID,
+		Token:     token,
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	result, err := database.ContactInvites.InsertOne(ctx, invite)
+	if err != nil {
+		return nil, err
+	}
+
+	invite.ID = result.InsertedID.(primitive.ObjectID)
+	return invite, nil
+}
+
+// GetUserContactInvites lists a user's invite links, newest first, including used up ones
+func GetUserContactInvites(userID primitive.ObjectID) ([]ContactInvite, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := database.ContactInvites.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	invites := []ContactInvite{}
+	if err := cursor.All(ctx, &invites); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// CountUserContactInvites counts a user's invite links
+func CountUserContactInvites(userID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return database.ContactInvites.CountDocuments(ctx, bson.M{"user_id": userID})
+}
+
+// FindContactInvite finds one of a user's invite links
+func FindContactInvite(id, userID primitive.ObjectID) (*ContactInvite, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var invite ContactInvite
+	err := database.ContactInvites.FindOne(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&invite)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// FindUsableContactInvite finds an invite by token, if it has not expired or run out of uses
+func FindUsableContactInvite(token string) (*ContactInvite, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var invite ContactInvite
+	err := database.ContactInvites.FindOne(ctx, usableInviteFilter(bson.M{"token": token})).Decode(&invite)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// UseContactInvite counts one use of an invite, reporting false if it is no longer usable.
+// The check and the increment are a single update, so the usage cap holds under concurrency.
+func UseContactInvite(id primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.ContactInvites.UpdateOne(
+		ctx,
+		usableInviteFilter(bson.M{"_id": id}),
+		bson.M{"$inc": bson.M{"uses": 1}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// DeleteContactInvite revokes one of a user's invite links
+func DeleteContactInvite(id, userID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.ContactInvites.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// DeleteUserContactInvites revokes all of a user's invite links
+func DeleteUserContactInvites(userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.ContactInvites.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrContactRequestExists is returned when a pending request between the same users already exists
+var ErrContactRequestExists = errors.New("contact request already exists")
+
+// ContactRequest is a pending request to become mutual contacts.
+// Accepting, declining or cancelling a request deletes it.
+type ContactRequest struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	FromID    primitive.ObjectID `bson:"from_id" json:"from_id"`
+	ToID      primitive.ObjectID `bson:"to_id" json:"to_id"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// ContactRequestWithUser is a request together with the other party's public info
+type ContactRequestWithUser struct {
+	ContactRequest
+	User *UserPublic `json:"user,omitempty"`
+}
+
+// CreateContactRequest creates a pending contact request
+func CreateContactRequest(fromID, toID primitive.ObjectID) (*ContactRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := &ContactRequest{
+		FromID:    fromID,
+		ToID:      toID,
+		CreatedAt: time.Now(),
+	}
+
+	result, err := database.ContactRequests.InsertOne(ctx, req)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrContactRequestExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req.ID = result.InsertedID.(primitive.ObjectID)
+	return req, nil
+}
+
+// FindContactRequestByID finds a contact request by ID
+func FindContactRequestByID(id primitive.ObjectID) (*ContactRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var req ContactRequest
+	err := database.ContactRequests.FindOne(ctx, bson.M{"_id": id}).Decode(&req)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// FindContactRequest finds the pending request from one user to another
+func FindContactRequest(fromID, toID primitive.ObjectID) (*ContactRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var req ContactRequest
+	err := database.ContactRequests.FindOne(ctx, bson.M{"from_id": fromID, "to_id": toID}).Decode(&req)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// GetIncomingContactRequests gets the requests sent to a user, newest first
+func GetIncomingContactRequests(userID primitive.ObjectID) ([]ContactRequest, error) {
+	return findContactRequests(bson.M{"to_id": userID})
+}
+
+// GetOutgoingContactRequests gets the requests a user has sent, newest first
+func GetOutgoingContactRequests(userID primitive.ObjectID) ([]ContactRequest, error) {
+	return findContactRequests(bson.M{"from_id": userID})
+}
+
+func findContactRequests(filter bson.M) ([]ContactRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := database.ContactRequests.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	requests := []ContactRequest{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// DeleteContactRequest deletes a contact request, reporting whether it still existed
+func DeleteContactRequest(id primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.ContactRequests.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// DeleteUserContactRequests deletes every request sent by or to a user
+func DeleteUserContactRequests(userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.ContactRequests.DeleteMany(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"from_id": userID},
+			bson.M{"to_id": userID},
+		},
+	})
+	return err
+}
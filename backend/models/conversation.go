@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"strconv"
 	"time"
 
 	"github.com/vinneth/go-webchat/database"
@@ -17,15 +18,23 @@ const (
 	ConversationTypeGroup   ConversationType = "group"
 )
 
+// MaxPinnedMessages limits how many messages can be pinned in a conversation
+const MaxPinnedMessages = 50
+
 type Conversation struct {
-	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
-	Type      ConversationType     `bson:"type" json:"type"`
-	Members   []primitive.ObjectID `bson:"members" json:"members"`
-	GroupName string               `bson:"group_name,omitempty" json:"group_name,omitempty"`
-	GroupIcon string               `bson:"group_icon,omitempty" json:"group_icon,omitempty"`
-	Admin     primitive.ObjectID   `bson:"admin,omitempty" json:"admin,omitempty"`
-	CreatedAt time.Time            `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time            `bson:"updated_at" json:"updated_at"`
+	ID             primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Type           ConversationType     `bson:"type" json:"type"`
+	Members        []primitive.ObjectID `bson:"members" json:"members"`
+	GroupName      string               `bson:"group_name,omitempty" json:"group_name,omitempty"`
+	GroupIcon      string               `bson:"group_icon,omitempty" json:"group_icon,omitempty"`
+	IconMedia      string               `bson:"icon_media,omitempty" json:"-"` // Media ID when the icon is stored locally
+	Owner          primitive.ObjectID   `bson:"owner,omitempty" json:"owner,omitempty"`
+	Admins         []primitive.ObjectID `bson:"admins,omitempty" json:"admins,omitempty"`
+	Moderators     []primitive.ObjectID `bson:"moderators,omitempty" json:"moderators,omitempty"`
+	PinnedMessages []primitive.ObjectID `bson:"pinned_messages,omitempty" json:"pinned_messages,omitempty"` // Oldest pin first
+	Encrypted      bool                 `bson:"encrypted,omitempty" json:"encrypted,omitempty"`             // End-to-end encrypted private chat
+	CreatedAt      time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time            `bson:"updated_at" json:"updated_at"`
 }
 
 type ConversationWithDetails struct {
@@ -53,19 +62,26 @@ func CreateConversation(conv *Conversation) error {
 	return nil
 }
 
-// FindPrivateConversation finds an existing private conversation between two users
-func FindPrivateConversation(user1ID, user2ID primitive.ObjectID) (*Conversation, error) {
+// FindPrivateConversation finds an existing private conversation between two users.
+// Two users can have one plaintext and one end-to-end encrypted conversation.
+func FindPrivateConversation(user1ID, user2ID primitive.ObjectID, encrypted bool) (*Conversation, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var conv Conversation
-	err := database.Conversations.FindOne(ctx, bson.M{
+	filter := bson.M{
 		"type": ConversationTypePrivate,
 		"members": bson.M{
 			"$all":  []primitive.ObjectID{user1ID, user2ID},
 			"$size": 2,
 		},
-	}).Decode(&conv)
+		"encrypted": bson.M{"$ne": true},
+	}
+	if encrypted {
+		filter["encrypted"] = true
+	}
+
+	var conv Conversation
+	err := database.Conversations.FindOne(ctx, filter).Decode(&conv)
 
 	if err != nil {
 		return nil, err
@@ -74,16 +90,17 @@ func FindPrivateConversation(user1ID, user2ID primitive.ObjectID) (*Conversation
 }
 
 // GetOrCreatePrivateConversation gets or creates a private conversation
-func GetOrCreatePrivateConversation(user1ID, user2ID primitive.ObjectID) (*Conversation, error) {
-	conv, err := FindPrivateConversation(user1ID, user2ID)
+func GetOrCreatePrivateConversation(user1ID, user2ID primitive.ObjectID, encrypted bool) (*Conversation, error) {
+	conv, err := FindPrivateConversation(user1ID, user2ID, encrypted)
 	if err == nil && conv != nil {
 		return conv, nil
 	}
 
 	// Create new conversation
 	newConv := &Conversation{
-		Type:    ConversationTypePrivate,
-		Members: []primitive.ObjectID{user1ID, user2ID},
+		Type:      ConversationTypePrivate,
+		Members:   []primitive.ObjectID{user1ID, user2ID},
+		Encrypted: encrypted,
 	}
 
 	if err := CreateConversation(newConv); err != nil {
@@ -106,6 +123,17 @@ func FindConversationByID(id primitive.ObjectID) (*Conversation, error) {
 	return &conv, nil
 }
 
+// SharesConversation reports whether two users are members of a common conversation
+func SharesConversation(user1ID, user2ID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := database.Conversations.CountDocuments(ctx, bson.M{
+		"members": bson.M{"$all": bson.A{user1ID, user2ID}},
+	})
+	return count > 0, err
+}
+
 // GetUserConversations gets all conversations for a user
 func GetUserConversations(userID primitive.ObjectID) ([]Conversation, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -142,9 +170,9 @@ func UpdateConversationTimestamp(convID primitive.ObjectID) error {
 }
 
 // CreateGroup creates a new group conversation
-func CreateGroup(name string, icon string, adminID primitive.ObjectID, memberIDs []primitive.ObjectID) (*Conversation, error) {
+func CreateGroup(name string, icon string, ownerID primitive.ObjectID, memberIDs []primitive.ObjectID) (*Conversation, error) {
 	// Ensure admin is in members
-	members := append([]primitive.ObjectID{adminID}, memberIDs...)
+	members := append([]primitive.ObjectID{ownerID}, memberIDs...)
 
 	// Remove duplicates
 	seen := make(map[primitive.ObjectID]bool)
@@ -161,7 +189,7 @@ func CreateGroup(name string, icon string, adminID primitive.ObjectID, memberIDs
 		Members:   uniqueMembers,
 		GroupName: name,
 		GroupIcon: icon,
-		Admin:     adminID,
+		Owner:     ownerID,
 	}
 
 	if err := CreateConversation(conv); err != nil {
@@ -181,7 +209,9 @@ func UpdateGroup(convID primitive.ObjectID, name, icon string) error {
 		update["group_name"] = name
 	}
 	if icon != "" {
+		// An icon URL replaces any uploaded icon
 		update["group_icon"] = icon
+		update["icon_media"] = ""
 	}
 
 	_, err := database.Conversations.UpdateOne(
@@ -192,6 +222,23 @@ func UpdateGroup(convID primitive.ObjectID, name, icon string) error {
 	return err
 }
 
+// SetGroupIcon sets a group's icon URL and the media ID of its locally stored image
+func SetGroupIcon(convID primitive.ObjectID, icon, mediaID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Conversations.UpdateOne(
+		ctx,
+		bson.M{"_id": convID},
+		bson.M{"$set": bson.M{
+			"group_icon": icon,
+			"icon_media": mediaID,
+			"updated_at": time.Now(),
+		}},
+	)
+	return err
+}
+
 // AddGroupMember adds a member to a group
 func AddGroupMember(convID, memberID primitive.ObjectID) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -208,6 +255,25 @@ func AddGroupMember(convID, memberID primitive.ObjectID) error {
 	return err
 }
 
+// JoinGroup adds a member to a group unless they already belong to it, and reports whether they were added
+func JoinGroup(convID, memberID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.Conversations.UpdateOne(
+		ctx,
+		bson.M{"_id": convID, "members": bson.M{"$ne": memberID}},
+		bson.M{
+			"$push": bson.M{"members": memberID},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
 // RemoveGroupMember removes a member from a group
 func RemoveGroupMember(convID, memberID primitive.ObjectID) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -217,7 +283,7 @@ func RemoveGroupMember(convID, memberID primitive.ObjectID) error {
 		ctx,
 		bson.M{"_id": convID},
 		bson.M{
-			"$pull": bson.M{"members": memberID},
+			"$pull": bson.M{"members": memberID, "admins": memberID, "moderators": memberID},
 			"$set":  bson.M{"updated_at": time.Now()},
 		},
 	)
@@ -238,3 +304,60 @@ func IsMember(convID, userID primitive.ObjectID) (bool, error) {
 	}
 	return count > 0, nil
 }
+
+// PinMessage pins a message in a conversation, reporting false if MaxPinnedMessages are already pinned
+func PinMessage(convID, msgID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The size check and the push are one update, so the limit holds under concurrency
+	result, err := database.Conversations.UpdateOne(
+		ctx,
+		bson.M{
+			"_id": convID,
+			"$or": bson.A{
+				bson.M{"pinned_messages": msgID},
+				bson.M{"pinned_messages." + strconv.Itoa(MaxPinnedMessages-1): bson.M{"$exists": false}},
+			},
+		},
+		bson.M{"$addToSet": bson.M{"pinned_messages": msgID}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// UnpinMessage unpins a message in a conversation
+func UnpinMessage(convID, msgID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Conversations.UpdateOne(
+		ctx,
+		bson.M{"_id": convID},
+		bson.M{"$pull": bson.M{"pinned_messages": msgID}},
+	)
+	return err
+}
+
+// DeleteConversation deletes a conversation with all of its messages, invite links and join requests
+func DeleteConversation(convID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := database.Messages.DeleteMany(ctx, bson.M{"conversation_id": convID}); err != nil {
+		return err
+	}
+
+	if _, err := database.GroupInvites.DeleteMany(ctx, bson.M{"group_id": convID}); err != nil {
+		return err
+	}
+
+	if _, err := database.GroupJoinRequests.DeleteMany(ctx, bson.M{"group_id": convID}); err != nil {
+		return err
+	}
+
+	_, err := database.Conversations.DeleteOne(ctx, bson.M{"_id": convID})
+	return err
+}
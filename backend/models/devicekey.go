@@ -0,0 +1,223 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// MaxDevicesPerUser limits how many devices a user can register keys for
+	MaxDevicesPerUser = 10
+	// MaxOneTimePreKeys limits how many unused one-time prekeys a device can store
+	MaxOneTimePreKeys = 200
+	// maxPublicKeySize is the largest accepted decoded key or signature, in bytes
+	maxPublicKeySize = 1024
+)
+
+// PreKey is a public prekey published by a device
+type PreKey struct {
+	KeyID     int    `bson:"key_id" json:"key_id"`
+	PublicKey string `bson:"public_key" json:"public_key"` // Base64
+}
+
+// SignedPreKey is a medium-term prekey signed with the device's identity key
+type SignedPreKey struct {
+	KeyID     int    `bson:"key_id" json:"key_id"`
+	PublicKey string `bson:"public_key" json:"public_key"` // Base64
+	Signature string `bson:"signature" json:"signature"`   // Base64
+}
+
+// DeviceKeys is the public key material of one of a user's devices.
+// The server only ever sees public keys; private keys never leave the device.
+type DeviceKeys struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"user_id"`
+	DeviceID       string             `bson:"device_id" json:"device_id"`
+	Name           string             `bson:"name,omitempty" json:"name,omitempty"`
+	IdentityKey    string             `bson:"identity_key" json:"identity_key"` // Base64
+	SignedPreKey   SignedPreKey       `bson:"signed_prekey" json:"signed_prekey"`
+	OneTimePreKeys []PreKey           `bson:"one_time_prekeys" json:"-"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// PreKeyBundle is what a sender needs to start an encrypted session with a device
+type PreKeyBundle struct {
+	UserID        primitive.ObjectID `json:"user_id"`
+	DeviceID      string             `json:"device_id"`
+	IdentityKey   string             `json:"identity_key"`
+	SignedPreKey  SignedPreKey       `json:"signed_prekey"`
+	OneTimePreKey *PreKey            `json:"one_time_prekey,omitempty"` // Nil once the device has run out
+}
+
+// ValidPublicKey reports whether s is a plausible base64-encoded key or signature
+func ValidPublicKey(s string) bool {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	return err == nil && len(raw) > 0 && len(raw) <= maxPublicKeySize
+}
+
+// SaveDeviceKeys registers a device, or replaces all of its keys if it already exists
+func SaveDeviceKeys(keys *DeviceKeys) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if keys.OneTimePreKeys == nil {
+		keys.OneTimePreKeys = []PreKey{}
+	}
+	keys.UpdatedAt = time.Now()
+
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After)
+
+	return database.DeviceKeys.FindOneAndUpdate(
+		ctx,
+		bson.M{"user_id": keys.UserID, "device_id": keys.DeviceID},
+		bson.M{
+			"$set": bson.M{
+				"name":             keys.Name,
+				"identity_key":     keys.IdentityKey,
+				"signed_prekey":    keys.SignedPreKey,
+				"one_time_prekeys": keys.OneTimePreKeys,
+				"updated_at":       keys.UpdatedAt,
+			},
+			"$setOnInsert": bson.M{"created_at": keys.UpdatedAt},
+		},
+		opts,
+	).Decode(keys)
+}
+
+// AddOneTimePreKeys appends one-time prekeys to a device, keeping at most MaxOneTimePreKeys
+func AddOneTimePreKeys(userID primitive.ObjectID, deviceID string, preKeys []PreKey) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.DeviceKeys.UpdateOne(
+		ctx,
+		bson.M{"user_id": userID, "device_id": deviceID},
+		bson.M{
+			"$push": bson.M{"one_time_prekeys": bson.M{
+				"$each":  preKeys,
+				"$slice": -MaxOneTimePreKeys,
+			}},
+			"$set": bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// FindDeviceKeys finds a single device of a user
+func FindDeviceKeys(userID primitive.ObjectID, deviceID string) (*DeviceKeys, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var keys DeviceKeys
+	err := database.DeviceKeys.FindOne(ctx, bson.M{"user_id": userID, "device_id": deviceID}).Decode(&keys)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &keys, nil
+}
+
+// GetUserDevices gets every device a user has registered keys for
+func GetUserDevices(userID primitive.ObjectID) ([]DeviceKeys, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": 1})
+	cursor, err := database.DeviceKeys.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	devices := []DeviceKeys{}
+	if err := cursor.All(ctx, &devices); err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// CountUserDevices counts the devices a user has registered keys for
+func CountUserDevices(userID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return database.DeviceKeys.CountDocuments(ctx, bson.M{"user_id": userID})
+}
+
+// ClaimPreKeyBundles returns a prekey bundle for each of a user's devices.
+// Each one-time prekey is handed out at most once.
+func ClaimPreKeyBundles(userID primitive.ObjectID) ([]PreKeyBundle, error) {
+	devices, err := GetUserDevices(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	bundles := make([]PreKeyBundle, 0, len(devices))
+	for _, device := range devices {
+		bundle := PreKeyBundle{
+			UserID:       device.UserID,
+			DeviceID:     device.DeviceID,
+			IdentityKey:  device.IdentityKey,
+			SignedPreKey: device.SignedPreKey,
+		}
+
+		// Pop the oldest one-time prekey, returning the document as it was before
+		var before DeviceKeys
+		err := database.DeviceKeys.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": device.ID, "one_time_prekeys.0": bson.M{"$exists": true}},
+			bson.M{"$pop": bson.M{"one_time_prekeys": -1}},
+			options.FindOneAndUpdate().SetReturnDocument(options.Before),
+		).Decode(&before)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		if err == nil && len(before.OneTimePreKeys) > 0 {
+			bundle.OneTimePreKey = &before.OneTimePreKeys[0]
+		}
+
+		bundles = append(bundles, bundle)
+	}
+
+	return bundles, nil
+}
+
+// DeleteDeviceKeys removes a device's keys
+func DeleteDeviceKeys(userID primitive.ObjectID, deviceID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.DeviceKeys.DeleteOne(ctx, bson.M{"user_id": userID, "device_id": deviceID})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// DeleteAllDeviceKeys removes the keys of every device of a user
+func DeleteAllDeviceKeys(userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.DeviceKeys.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DiscoveredUser is a user search result with how they are connected to the searcher
+type DiscoveredUser struct {
+	User           `bson:",inline"`
+	MutualContacts int  `bson:"mutual_contacts"`
+	SharedGroup    bool `bson:"shared_group"`
+}
+
+// maxNameSearchWords limits how many words of a name can start a search match
+const maxNameSearchWords = 8
+
+// NameSearchKeys returns the lowercase name starting from each of its words, e.g.
+// "Ada King Lovelace" gives "ada king lovelace", "king lovelace" and "lovelace". A query
+// then matches any word of the name by an indexed prefix search.
+func NameSearchKeys(name string) []string {
+	words := strings.Fields(strings.ToLower(name))
+	if len(words) > maxNameSearchWords {
+		words = words[:maxNameSearchWords]
+	}
+
+	keys := make([]string, 0, len(words))
+	for i := range words {
+		keys = append(keys, strings.Join(words[i:], " "))
+	}
+	return keys
+}
+
+// MigrateNameSearch fills in the name search keys of users from before discovery used them.
+// It is safe to run on every start.
+func MigrateNameSearch() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	filter := bson.M{
+		"name_search": bson.M{"$exists": false},
+		"name":        bson.M{"$ne": ""},
+		"deleted":     bson.M{"$ne": true},
+	}
+	cursor, err := database.Users.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1, "name": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var user User
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+
+		_, err := database.Users.UpdateOne(
+			ctx,
+			bson.M{"_id": user.ID, "name": user.Name},
+			bson.M{"$set": bson.M{"name_search": NameSearchKeys(user.Name)}},
+		)
+		if err != nil {
+			return err
+		}
+		migrated++
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	if migrated > 0 {
+		log.Printf("Indexed the names of %d users for search", migrated)
+	}
+	return nil
+}
+
+// DiscoverUsers searches users by display name or unique ID prefix on behalf of viewer.
+// Users who are connected to the viewer through mutual contacts or a shared group come first.
+// Results honor each user's discoverability setting and blocks in both directions.
+func DiscoverUsers(viewer *User, query string, skip, limit int64) ([]DiscoveredUser, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query = strings.TrimSpace(query)
+	uniqueID := NormalizeUniqueID(query)
+	name := strings.Join(strings.Fields(strings.ToLower(query)), " ")
+
+	viewerContacts := viewer.ContactIDs()
+	excluded := append([]primitive.ObjectID{viewer.ID}, viewer.Blocked...)
+
+	// Members of the viewer's groups
+	groupMembers := []primitive.ObjectID{}
+	conversations, err := GetUserConversations(viewer.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, conv := range conversations {
+		if conv.Type == ConversationTypeGroup {
+			groupMembers = append(groupMembers, conv.Members...)
+		}
+	}
+
+	filter := bson.M{
+		"_id":        bson.M{"$nin": excluded},
+		"blocked":    bson.M{"$ne": viewer.ID},
+		"is_bot":     bson.M{"$ne": true},
+		"deleted":    bson.M{"$ne": true},
+		"suspension": bson.M{"$exists": false},
+		"$and": bson.A{
+			// A word of the display name or the unique ID starts with the query; both use an index
+			bson.M{"$or": bson.A{
+				bson.M{"name_search": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(name)}},
+				bson.M{"unique_id": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(uniqueID)}},
+			}},
+			// Same rules as User.DiscoverableBy
+			bson.M{"$or": bson.A{
+				bson.M{"privacy.discoverability": bson.M{"$nin": bson.A{DiscoverContactsOfContacts, DiscoverNobody}}},
+				bson.M{"contacts.user_id": viewer.ID},
+				bson.M{
+					"privacy.discoverability": DiscoverContactsOfContacts,
+					"contacts.user_id":        bson.M{"$in": viewerContacts},
+				},
+			}},
+		},
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": filter},
+		bson.M{"$addFields": bson.M{
+			"exact_match": bson.M{"$eq": bson.A{"$unique_id", uniqueID}},
+			"mutual_contacts": bson.M{"$size": bson.M{"$setIntersection": bson.A{
+				bson.M{"$ifNull": bson.A{"$contacts.user_id", bson.A{}}},
+				viewerContacts,
+			}}},
+			"shared_group": bson.M{"$in": bson.A{"$_id", groupMembers}},
+		}},
+		bson.M{"$addFields": bson.M{
+			"connected": bson.M{"$or": bson.A{
+				bson.M{"$gt": bson.A{"$mutual_contacts", 0}},
+				"$shared_group",
+			}},
+		}},
+		bson.M{"$facet": bson.M{
+			"total": bson.A{bson.M{"$count": "count"}},
+			"users": bson.A{
+				bson.M{"$sort": bson.D{
+					{Key: "exact_match", Value: -1},
+					{Key: "connected", Value: -1},
+					{Key: "mutual_contacts", Value: -1},
+					{Key: "name", Value: 1},
+					{Key: "_id", Value: 1},
+				}},
+				bson.M{"$skip": skip},
+				bson.M{"$limit": limit},
+			},
+		}},
+	}
+
+	cursor, err := database.Users.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+		Users []DiscoveredUser `bson:"users"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, 0, err
+	}
+
+	if len(result) == 0 || len(result[0].Total) == 0 {
+		return []DiscoveredUser{}, 0, nil
+	}
+	return result[0].Users, result[0].Total[0].Count, nil
+}
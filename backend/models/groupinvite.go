@@ -0,0 +1,144 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxGroupInvitesPerGroup limits how many invite links a group can have at once
+const MaxGroupInvitesPerGroup = 20
+
+// GroupInvite is a shareable link that lets anyone holding it join a group,
+// or ask to join when approval is required
+type GroupInvite struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	GroupID          primitive.ObjectID `bson:"group_id" json:"group_id"`
+	CreatedBy        primitive.ObjectID `bson:"created_by" json:"created_by"`
+	Token            string             `bson:"token" json:"token"`
+	MaxUses          int                `bson:"max_uses,omitempty" json:"max_uses,omitempty"` // Zero for unlimited
+	Uses             int                `bson:"uses" json:"uses"`
+	ApprovalRequired bool               `bson:"approval_required,omitempty" json:"approval_required"`
+	ExpiresAt        *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// CreateGroupInvite creates an invite link for a group
+func CreateGroupInvite(groupID, createdBy primitive.ObjectID, maxUses int, approvalRequired bool, expiresAt *time.Time) (*GroupInvite, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token, err := NewRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	invite := &GroupInvite{
+		GroupID:          groupID,
+		CreatedBy:        createdBy,
+		Token:            token,
+		MaxUses:          maxUses,
+		ApprovalRequired: approvalRequired,
+		ExpiresAt:        expiresAt,
+		CreatedAt:        time.Now(),
+	}
+
+	result, err := database.GroupInvites.InsertOne(ctx, invite)
+	if err != nil {
+		return nil, err
+	}
+
+	invite.ID = result.InsertedID.(primitive.ObjectID)
+	return invite, nil
+}
+
+// GetGroupInvites lists a group's invite links, newest first, including used up ones
+func GetGroupInvites(groupID primitive.ObjectID) ([]GroupInvite, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := database.GroupInvites.Find(ctx, bson.M{"group_id": groupID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	invites := []GroupInvite{}
+	if err := cursor.All(ctx, &invites); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// CountGroupInvites counts a group's invite links
+func CountGroupInvites(groupID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return database.GroupInvites.CountDocuments(ctx, bson.M{"group_id": groupID})
+}
+
+// FindUsableGroupInvite finds a group invite by token, if it has not expired or run out of uses
+func FindUsableGroupInvite(token string) (*GroupInvite, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var invite GroupInvite
+	err := database.GroupInvites.FindOne(ctx, usableInviteFilter(bson.M{"token": token})).Decode(&invite)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// UseGroupInvite counts one use of a group invite, reporting false if it is no longer usable.
+// The check and the increment are a single update, so the usage cap holds under concurrency.
+func UseGroupInvite(id primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.GroupInvites.UpdateOne(
+		ctx,
+		usableInviteFilter(bson.M{"_id": id}),
+		bson.M{"$inc": bson.M{"uses": 1}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// RefundGroupInvite gives back a use of an invite link, e.g. when a join request through it is
+// rejected or cancelled
+func RefundGroupInvite(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.GroupInvites.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "uses": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"uses": -1}},
+	)
+	return err
+}
+
+// DeleteGroupInvite revokes one of a group's invite links
+func DeleteGroupInvite(id, groupID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.GroupInvites.DeleteOne(ctx, bson.M{"_id": id, "group_id": groupID})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
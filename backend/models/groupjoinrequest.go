@@ -0,0 +1,151 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrJoinRequestExists is returned when the user already has a pending request to join the group
+var ErrJoinRequestExists = errors.New("join request already exists")
+
+// GroupJoinRequest is a pending request to join a group that requires approval.
+// Approving, rejecting or cancelling a request deletes it.
+type GroupJoinRequest struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	GroupID   primitive.ObjectID `bson:"group_id" json:"group_id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	InviteID  primitive.ObjectID `bson:"invite_id,omitempty" json:"invite_id,omitempty"` // Invite link the request came through
+	Message   string             `bson:"message,omitempty" json:"message,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// GroupJoinRequestWithUser is a join request together with the requester's public info
+type GroupJoinRequestWithUser struct {
+	GroupJoinRequest
+	User *UserPublic `json:"user,omitempty"`
+}
+
+// CreateGroupJoinRequest creates a pending request to join a group
+func CreateGroupJoinRequest(groupID, userID, inviteID primitive.ObjectID, message string) (*GroupJoinRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := &GroupJoinRequest{
+		GroupID:   groupID,
+		UserID:    userID,
+		InviteID:  inviteID,
+		Message:   message,
+		CreatedAt: time.Now(),
+	}
+
+	result, err := database.GroupJoinRequests.InsertOne(ctx, req)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrJoinRequestExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req.ID = result.InsertedID.(primitive.ObjectID)
+	return req, nil
+}
+
+// FindGroupJoinRequest finds one of a group's join requests
+func FindGroupJoinRequest(id, groupID primitive.ObjectID) (*GroupJoinRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var req GroupJoinRequest
+	err := database.GroupJoinRequests.FindOne(ctx, bson.M{"_id": id, "group_id": groupID}).Decode(&req)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// GetGroupJoinRequests gets a group's pending join requests, oldest first
+func GetGroupJoinRequests(groupID primitive.ObjectID) ([]GroupJoinRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": 1})
+	cursor, err := database.GroupJoinRequests.Find(ctx, bson.M{"group_id": groupID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	requests := []GroupJoinRequest{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// GetUserGroupJoinRequests gets the pending requests a user has made to join groups, newest first
+func GetUserGroupJoinRequests(userID primitive.ObjectID) ([]GroupJoinRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := database.GroupJoinRequests.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	requests := []GroupJoinRequest{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// CancelGroupJoinRequest deletes one of the user's join requests and returns it, or nil if it no longer exists
+func CancelGroupJoinRequest(id, userID primitive.ObjectID) (*GroupJoinRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var req GroupJoinRequest
+	err := database.GroupJoinRequests.FindOneAndDelete(ctx, bson.M{"_id": id, "user_id": userID}).Decode(&req)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// DeleteGroupJoinRequest deletes a join request, reporting whether it still existed
+func DeleteGroupJoinRequest(id primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.GroupJoinRequests.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// DeleteUserGroupJoinRequests deletes every join request a user has made
+func DeleteUserGroupJoinRequests(userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.GroupJoinRequests.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
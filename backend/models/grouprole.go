@@ -0,0 +1,204 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GroupRole is a member's role within a group
+type GroupRole string
+
+const (
+	GroupRoleOwner     GroupRole = "owner"
+	GroupRoleAdmin     GroupRole = "admin"
+	GroupRoleModerator GroupRole = "moderator"
+	GroupRoleMember    GroupRole = "member"
+)
+
+// GroupPermission is an action in a group that only some roles may take
+type GroupPermission string
+
+const (
+	PermEditGroupInfo  GroupPermission = "edit_info"
+	PermAddMembers     GroupPermission = "add_members"
+	PermRemoveMembers  GroupPermission = "remove_members"
+	PermDeleteMessages GroupPermission = "delete_messages" // Messages sent by others; anyone can delete their own
+	PermPinMessages    GroupPermission = "pin_messages"
+	PermManageRoles    GroupPermission = "manage_roles"
+)
+
+// groupPermissions is the permission matrix; the owner can do everything
+var groupPermissions = map[GroupRole][]GroupPermission{
+	GroupRoleAdmin:     {PermEditGroupInfo, PermAddMembers, PermRemoveMembers, PermDeleteMessages, PermPinMessages, PermManageRoles},
+	GroupRoleModerator: {PermRemoveMembers, PermDeleteMessages, PermPinMessages},
+	GroupRoleMember:    {},
+}
+
+// groupRoleRanks orders roles from least to most privileged
+var groupRoleRanks = map[GroupRole]int{
+	GroupRoleMember:    1,
+	GroupRoleModerator: 2,
+	GroupRoleAdmin:     3,
+	GroupRoleOwner:     4,
+}
+
+// ValidGroupRole reports whether role is a role that can be assigned to a member.
+// Ownership can only be transferred.
+func ValidGroupRole(role GroupRole) bool {
+	return role == GroupRoleAdmin || role == GroupRoleModerator || role == GroupRoleMember
+}
+
+// Outranks reports whether role is more privileged than other
+func (role GroupRole) Outranks(other GroupRole) bool {
+	return groupRoleRanks[role] > groupRoleRanks[other]
+}
+
+// RoleOf returns a member's role in the group, or "" if they are not a member
+func (c *Conversation) RoleOf(userID primitive.ObjectID) GroupRole {
+	if !c.HasMember(userID) {
+		return ""
+	}
+	switch {
+	case c.Owner == userID:
+		return GroupRoleOwner
+	case containsID(c.Admins, userID):
+		return GroupRoleAdmin
+	case containsID(c.Moderators, userID):
+		return GroupRoleModerator
+	}
+	return GroupRoleMember
+}
+
+// Can reports whether a member's role grants a permission in the group
+func (c *Conversation) Can(userID primitive.ObjectID, perm GroupPermission) bool {
+	role := c.RoleOf(userID)
+	if role == GroupRoleOwner {
+		return true
+	}
+	for _, granted := range groupPermissions[role] {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// HasMember reports whether a user is a member of the conversation
+func (c *Conversation) HasMember(userID primitive.ObjectID) bool {
+	return containsID(c.Members, userID)
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// SetGroupRole changes the role of a group member other than the owner,
+// reporting false if they aren't such a member
+func SetGroupRole(convID, memberID primitive.ObjectID, role GroupRole) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"updated_at": time.Now()}}
+	switch role {
+	case GroupRoleAdmin:
+		update["$addToSet"] = bson.M{"admins": memberID}
+		update["$pull"] = bson.M{"moderators": memberID}
+	case GroupRoleModerator:
+		update["$addToSet"] = bson.M{"moderators": memberID}
+		update["$pull"] = bson.M{"admins": memberID}
+	default:
+		update["$pull"] = bson.M{"admins": memberID, "moderators": memberID}
+	}
+
+	result, err := database.Conversations.UpdateOne(
+		ctx,
+		bson.M{"_id": convID, "members": memberID, "owner": bson.M{"$ne": memberID}},
+		update,
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// TransferGroupOwnership makes a member the owner of a group in place of ownerID, who becomes an admin.
+// It reports false if ownerID no longer owns the group or newOwnerID isn't a member.
+func TransferGroupOwnership(convID, ownerID, newOwnerID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.Conversations.UpdateOne(
+		ctx,
+		bson.M{"_id": convID, "owner": ownerID, "members": newOwnerID},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"owner": newOwnerID,
+				"admins": bson.M{"$concatArrays": bson.A{
+					withoutID("$admins", newOwnerID),
+					bson.A{ownerID},
+				}},
+				"moderators": withoutID("$moderators", newOwnerID),
+				"updated_at": time.Now(),
+			}}},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// SetGroupOwner makes a member the owner of a group, for when the previous owner is gone
+func SetGroupOwner(convID, ownerID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Conversations.UpdateOne(
+		ctx,
+		bson.M{"_id": convID, "members": ownerID},
+		bson.M{
+			"$set":  bson.M{"owner": ownerID, "updated_at": time.Now()},
+			"$pull": bson.M{"admins": ownerID, "moderators": ownerID},
+		},
+	)
+	return err
+}
+
+// withoutID is an aggregation expression for an array field with an ID filtered out
+func withoutID(field string, id primitive.ObjectID) bson.M {
+	return bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{field, bson.A{}}},
+		"cond":  bson.M{"$ne": bson.A{"$$this", id}},
+	}}
+}
+
+// MigrateGroupOwners renames the admin field of groups from before group roles to owner.
+// It is safe to run on every start.
+func MigrateGroupOwners() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	result, err := database.Conversations.UpdateMany(
+		ctx,
+		bson.M{"admin": bson.M{"$exists": true}},
+		bson.M{"$rename": bson.M{"admin": "owner"}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Migrated the admins of %d groups to owners", result.ModifiedCount)
+	}
+	return nil
+}
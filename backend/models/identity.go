@@ -0,0 +1,113 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrIdentityInUse is returned when an identity belongs to another user
+	ErrIdentityInUse = errors.New("identity is linked to another account")
+	// ErrProviderAlreadyLinked is returned when the user already has an identity from the provider
+	ErrProviderAlreadyLinked = errors.New("provider is already linked")
+	// ErrLastLoginMethod is returned when unlinking would leave no way to sign in
+	ErrLastLoginMethod = errors.New("cannot remove the last sign-in method")
+)
+
+// Identity is an external sign-in identity linked to a user
+type Identity struct {
+	Provider string    `bson:"provider" json:"provider"`
+	Subject  string    `bson:"subject" json:"-"`
+	Email    string    `bson:"email,omitempty" json:"email,omitempty"`
+	LinkedAt time.Time `bson:"linked_at" json:"linked_at"`
+}
+
+// HasPassword reports whether the user can sign in with a password
+func (u *User) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
+// HasIdentity reports whether the user has an identity from the provider
+func (u *User) HasIdentity(provider string) bool {
+	for _, identity := range u.Identities {
+		if identity.Provider == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// FindUserByIdentity finds the user an external identity is linked to
+func FindUserByIdentity(provider, subject string) (*User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user User
+	err := database.Users.FindOne(ctx, bson.M{
+		"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}},
+	}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// LinkIdentity links an external identity to a user who has none from that provider yet
+func LinkIdentity(userID primitive.ObjectID, identity Identity) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	identity.LinkedAt = time.Now()
+
+	result, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID, "identities.provider": bson.M{"$ne": identity.Provider}},
+		bson.M{"$push": bson.M{"identities": identity}},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrIdentityInUse
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrProviderAlreadyLinked
+	}
+	return nil
+}
+
+// UnlinkIdentity removes a provider's identity unless it is the user's last sign-in method
+func UnlinkIdentity(userID primitive.ObjectID, provider string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The filter only matches if another identity or a password remains afterwards
+	result, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{
+			"_id":                 userID,
+			"identities.provider": provider,
+			"$or": bson.A{
+				bson.M{"password_hash": bson.M{"$exists": true, "$ne": ""}},
+				bson.M{"identities.1": bson.M{"$exists": true}},
+			},
+		},
+		bson.M{"$pull": bson.M{"identities": bson.M{"provider": provider}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrLastLoginMethod
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/vinneth/go-webchat/database"
@@ -18,11 +19,33 @@ const (
 	MessageStatusRead      MessageStatus = "read"
 )
 
+type MessageType string
+
+const (
+	MessageTypeText      MessageType = "text"
+	MessageTypeEncrypted MessageType = "encrypted"
+)
+
+// MaxCiphertextSize limits the size of an encrypted message payload, in bytes
+const MaxCiphertextSize = 64 * 1024
+
+var (
+	// ErrPlaintextInEncrypted is returned when a plaintext message is sent to an encrypted conversation
+	ErrPlaintextInEncrypted = errors.New("conversation is end-to-end encrypted")
+	// ErrEncryptedInPlaintext is returned when an encrypted message is sent to a plaintext conversation
+	ErrEncryptedInPlaintext = errors.New("conversation is not end-to-end encrypted")
+	// ErrInvalidMessage is returned for messages without content or with an oversized payload
+	ErrInvalidMessage = errors.New("invalid message")
+)
+
 type Message struct {
 	ID             primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
 	ConversationID primitive.ObjectID   `bson:"conversation_id" json:"conversation_id"`
 	SenderID       primitive.ObjectID   `bson:"sender_id" json:"sender_id"`
+	Type           MessageType          `bson:"type,omitempty" json:"type,omitempty"` // Empty for older text messages
 	Content        string               `bson:"content" json:"content"`
+	Ciphertext     string               `bson:"ciphertext,omitempty" json:"ciphertext,omitempty"`       // Opaque to the server
+	SenderDevice   string               `bson:"sender_device,omitempty" json:"sender_device,omitempty"` // Device that encrypted the message
 	Status         MessageStatus        `bson:"status" json:"status"`
 	ReadBy         []primitive.ObjectID `bson:"read_by" json:"read_by"`
 	CreatedAt      time.Time            `bson:"created_at" json:"created_at"`
@@ -33,11 +56,43 @@ type MessageWithSender struct {
 	Sender *UserPublic `json:"sender,omitempty"`
 }
 
+// IsEncrypted reports whether the message carries an end-to-end encrypted payload
+func (m *Message) IsEncrypted() bool {
+	return m.Type == MessageTypeEncrypted
+}
+
+// CheckMessage verifies that a message may be sent to a conversation.
+// Encrypted conversations only accept ciphertext and never plaintext content.
+func CheckMessage(conv *Conversation, msg *Message) error {
+	switch msg.Type {
+	case MessageTypeEncrypted:
+		if !conv.Encrypted {
+			return ErrEncryptedInPlaintext
+		}
+		if msg.Content != "" || msg.Ciphertext == "" || len(msg.Ciphertext) > MaxCiphertextSize {
+			return ErrInvalidMessage
+		}
+	case "", MessageTypeText:
+		if conv.Encrypted {
+			return ErrPlaintextInEncrypted
+		}
+		if msg.Content == "" || msg.Ciphertext != "" || msg.SenderDevice != "" {
+			return ErrInvalidMessage
+		}
+	default:
+		return ErrInvalidMessage
+	}
+	return nil
+}
+
 // CreateMessage creates a new message
 func CreateMessage(msg *Message) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if msg.Type == "" {
+		msg.Type = MessageTypeText
+	}
 	msg.CreatedAt = time.Now()
 	msg.Status = MessageStatusSent
 	msg.ReadBy = []primitive.ObjectID{msg.SenderID}
@@ -55,8 +110,8 @@ func CreateMessage(msg *Message) error {
 	return nil
 }
 
-// GetMessages gets messages for a conversation with pagination
-func GetMessages(conversationID primitive.ObjectID, limit, skip int64) ([]Message, error) {
+// GetMessages gets messages for a conversation with pagination, leaving out messages from hidden senders
+func GetMessages(conversationID primitive.ObjectID, limit, skip int64, hiddenSenders []primitive.ObjectID) ([]Message, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -65,9 +120,12 @@ func GetMessages(conversationID primitive.ObjectID, limit, skip int64) ([]Messag
 		SetLimit(limit).
 		SetSkip(skip)
 
-	cursor, err := database.Messages.Find(ctx, bson.M{
-		"conversation_id": conversationID,
-	}, opts)
+	filter := bson.M{"conversation_id": conversationID}
+	if len(hiddenSenders) > 0 {
+		filter["sender_id"] = bson.M{"$nin": hiddenSenders}
+	}
+
+	cursor, err := database.Messages.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -86,39 +144,62 @@ func GetMessages(conversationID primitive.ObjectID, limit, skip int64) ([]Messag
 	return messages, nil
 }
 
-// GetLastMessage gets the last message for a conversation
-func GetLastMessage(conversationID primitive.ObjectID) (*Message, error) {
+// GetLastMessage gets the last message for a conversation, leaving out messages from hidden senders
+func GetLastMessage(conversationID primitive.ObjectID, hiddenSenders []primitive.ObjectID) (*Message, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	opts := options.FindOne().SetSort(bson.M{"created_at": -1})
 
+	filter := bson.M{"conversation_id": conversationID}
+	if len(hiddenSenders) > 0 {
+		filter["sender_id"] = bson.M{"$nin": hiddenSenders}
+	}
+
 	var msg Message
-	err := database.Messages.FindOne(ctx, bson.M{
-		"conversation_id": conversationID,
-	}, opts).Decode(&msg)
+	err := database.Messages.FindOne(ctx, filter, opts).Decode(&msg)
 	if err != nil {
 		return nil, err
 	}
 	return &msg, nil
 }
 
-// MarkMessageAsRead marks a message as read by a user
-func MarkMessageAsRead(msgID, userID primitive.ObjectID) error {
+// MarkMessageAsRead marks a message as read by a user. The message status only
+// changes to read when the reader sends read receipts.
+func MarkMessageAsRead(msgID, userID primitive.ObjectID, receipt bool) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := database.Messages.UpdateOne(
-		ctx,
-		bson.M{"_id": msgID},
-		bson.M{
-			"$addToSet": bson.M{"read_by": userID},
-			"$set":      bson.M{"status": MessageStatusRead},
-		},
-	)
+	update := bson.M{"$addToSet": bson.M{"read_by": userID}}
+	if receipt {
+		update["$set"] = bson.M{"status": MessageStatusRead}
+	}
+
+	_, err := database.Messages.UpdateOne(ctx, bson.M{"_id": msgID}, update)
 	return err
 }
 
+// HideReaders removes users who don't send read receipts from the message's readers,
+// except for the viewer themselves
+func (m *Message) HideReaders(hidden []primitive.ObjectID, viewerID primitive.ObjectID) {
+	if len(hidden) == 0 {
+		return
+	}
+
+	skip := make(map[primitive.ObjectID]bool, len(hidden))
+	for _, id := range hidden {
+		skip[id] = id != viewerID
+	}
+
+	readBy := make([]primitive.ObjectID, 0, len(m.ReadBy))
+	for _, id := range m.ReadBy {
+		if !skip[id] {
+			readBy = append(readBy, id)
+		}
+	}
+	m.ReadBy = readBy
+}
+
 // MarkConversationAsRead marks all messages in a conversation as read by a user
 func MarkConversationAsRead(conversationID, userID primitive.ObjectID) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -150,14 +231,19 @@ func UpdateMessageStatus(msgID primitive.ObjectID, status MessageStatus) error {
 	return err
 }
 
-// GetUnreadCount gets unread message count for a user in a conversation
-func GetUnreadCount(conversationID, userID primitive.ObjectID) (int64, error) {
+// GetUnreadCount gets unread message count for a user in a conversation, leaving out messages from hidden senders
+func GetUnreadCount(conversationID, userID primitive.ObjectID, hiddenSenders []primitive.ObjectID) (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	senderFilter := bson.M{"$ne": userID}
+	if len(hiddenSenders) > 0 {
+		senderFilter["$nin"] = hiddenSenders
+	}
+
 	count, err := database.Messages.CountDocuments(ctx, bson.M{
 		"conversation_id": conversationID,
-		"sender_id":       bson.M{"$ne": userID},
+		"sender_id":       senderFilter,
 		"read_by":         bson.M{"$nin": []primitive.ObjectID{userID}},
 	})
 	return count, err
@@ -175,3 +261,40 @@ func FindMessageByID(id primitive.ObjectID) (*Message, error) {
 	}
 	return &msg, nil
 }
+
+// GetMessagesBySender gets every message a user has sent, oldest first
+func GetMessagesBySender(senderID primitive.ObjectID) ([]Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": 1})
+	cursor, err := database.Messages.Find(ctx, bson.M{"sender_id": senderID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	messages := []Message{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// DeleteMessage deletes a single message
+func DeleteMessage(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Messages.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// CountMessages counts the messages in a conversation
+func CountMessages(conversationID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return database.Messages.CountDocuments(ctx, bson.M{"conversation_id": conversationID})
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Who can find a user through search or their unique ID
+const (
+	DiscoverEveryone           = "everyone"
+	DiscoverContactsOfContacts = "contacts_of_contacts"
+	DiscoverNobody             = "nobody"
+)
+
+// Who can see a piece of profile information
+const (
+	VisibilityEveryone = "everyone"
+	VisibilityContacts = "contacts"
+	VisibilityNobody   = "nobody"
+)
+
+// PrivacySettings controls what other users can see and do
+type PrivacySettings struct {
+	Discoverability string `bson:"discoverability,omitempty" json:"discoverability"`
+	LastSeen        string `bson:"last_seen,omitempty" json:"last_seen"`
+	Online          string `bson:"online,omitempty" json:"online"`
+	ProfilePhoto    string `bson:"profile_photo,omitempty" json:"profile_photo"`
+	ReadReceipts    *bool  `bson:"read_receipts,omitempty" json:"read_receipts"` // Whether senders learn that their messages were read
+}
+
+// ValidDiscoverability reports whether a discoverability setting is known
+func ValidDiscoverability(setting string) bool {
+	switch setting {
+	case DiscoverEveryone, DiscoverContactsOfContacts, DiscoverNobody:
+		return true
+	}
+	return false
+}
+
+// ValidVisibility reports whether a visibility setting is known
+func ValidVisibility(setting string) bool {
+	switch setting {
+	case VisibilityEveryone, VisibilityContacts, VisibilityNobody:
+		return true
+	}
+	return false
+}
+
+// WithDefaults fills in unset privacy settings, which predate the setting or were never changed
+func (p PrivacySettings) WithDefaults() PrivacySettings {
+	if p.Discoverability == "" {
+		p.Discoverability = DiscoverEveryone
+	}
+	if p.LastSeen == "" {
+		p.LastSeen = VisibilityEveryone
+	}
+	if p.Online == "" {
+		p.Online = VisibilityEveryone
+	}
+	if p.ProfilePhoto == "" {
+		p.ProfilePhoto = VisibilityEveryone
+	}
+	if p.ReadReceipts == nil {
+		enabled := true
+		p.ReadReceipts = &enabled
+	}
+	return p
+}
+
+// HasContact reports whether a user is in the user's contacts
+func (u *User) HasContact(userID primitive.ObjectID) bool {
+	return u.FindContact(userID) != nil
+}
+
+// DiscoverableBy reports whether viewer may find the user by search or unique ID.
+// Existing contacts can always find each other.
+func (u *User) DiscoverableBy(viewer *User) bool {
+	if u.ID == viewer.ID || u.HasContact(viewer.ID) {
+		return true
+	}
+
+	switch u.Privacy.WithDefaults().Discoverability {
+	case DiscoverNobody:
+		return false
+	case DiscoverContactsOfContacts:
+		for _, entry := range viewer.Contacts {
+			if u.HasContact(entry.UserID) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// visibleTo reports whether viewerID may see information with the given visibility setting
+func (u *User) visibleTo(visibility string, viewerID primitive.ObjectID) bool {
+	if viewerID == u.ID {
+		return true
+	}
+	switch visibility {
+	case VisibilityNobody:
+		return false
+	case VisibilityContacts:
+		return u.HasContact(viewerID)
+	}
+	return true
+}
+
+// ShowsOnlineTo reports whether viewerID may see when the user is online
+func (u *User) ShowsOnlineTo(viewerID primitive.ObjectID) bool {
+	return !u.HasBlocked(viewerID) && u.visibleTo(u.Privacy.WithDefaults().Online, viewerID)
+}
+
+// SendsReadReceipts reports whether the user lets senders know they read their messages
+func (u *User) SendsReadReceipts() bool {
+	return *u.Privacy.WithDefaults().ReadReceipts
+}
+
+// GetUsersWithoutReadReceipts returns which of the given users have turned read receipts off
+func GetUsersWithoutReadReceipts(userIDs []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := database.Users.Find(ctx, bson.M{
+		"_id":                   bson.M{"$in": userIDs},
+		"privacy.read_receipts": false,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	return ids, nil
+}
+
+// UpdatePrivacy saves a user's privacy settings
+func UpdatePrivacy(userID primitive.ObjectID, privacy PrivacySettings) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"privacy": privacy}},
+	)
+	return err
+}
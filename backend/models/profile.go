@@ -0,0 +1,158 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"github.com/vinneth/go-webchat/media"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrUniqueIDTaken is returned when another user already has the unique ID
+	ErrUniqueIDTaken = errors.New("unique ID is already taken")
+	// ErrUniqueIDAlreadyChanged is returned when the user has used their one unique ID change
+	ErrUniqueIDAlreadyChanged = errors.New("unique ID can only be changed once")
+)
+
+// uniqueIDPattern matches IDs like #GOPRO-882: a hash, then 3-20 letters, digits or inner hyphens
+var uniqueIDPattern = regexp.MustCompile(`^#[A-Z0-9](?:[A-Z0-9-]{1,18})[A-Z0-9]$`)
+
+// NormalizeUniqueID upper-cases a unique ID and adds the leading hash if missing
+func NormalizeUniqueID(uniqueID string) string {
+	uniqueID = strings.ToUpper(strings.TrimSpace(uniqueID))
+	if !strings.HasPrefix(uniqueID, "#") {
+		uniqueID = "#" + uniqueID
+	}
+	return uniqueID
+}
+
+// ValidUniqueID reports whether a normalized unique ID may be chosen by a user
+func ValidUniqueID(uniqueID string) bool {
+	return uniqueIDPattern.MatchString(uniqueID) && !strings.HasPrefix(uniqueID, "#DELETED")
+}
+
+// ChangeUniqueID sets a user's unique ID, enforcing the once-only rule.
+// Uniqueness is guaranteed by the unique index on unique_id.
+func ChangeUniqueID(userID primitive.ObjectID, uniqueID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID, "unique_id_changed": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{
+			"unique_id":         uniqueID,
+			"unique_id_changed": true,
+		}},
+	)
+	if isDuplicateUniqueID(err) {
+		return ErrUniqueIDTaken
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUniqueIDAlreadyChanged
+	}
+	return nil
+}
+
+// UpdateProfile saves a user's name, bio and avatar
+func UpdateProfile(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{
+			"name":         user.Name,
+			"name_search":  NameSearchKeys(user.Name),
+			"bio":          user.Bio,
+			"avatar":       user.Avatar,
+			"avatar_media": user.AvatarMedia,
+		}},
+	)
+	return err
+}
+
+// UpdateAvatar sets a user's avatar URL and the media ID of its locally stored image
+func UpdateAvatar(userID primitive.ObjectID, avatar, mediaID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{
+			"avatar":       avatar,
+			"avatar_media": mediaID,
+		}},
+	)
+	return err
+}
+
+// remoteAvatarPattern matches the avatars generated by DiceBear, from before identicons were stored locally
+const remoteAvatarPattern = `^https://api\.dicebear\.com/`
+
+// MigrateRemoteAvatars replaces DiceBear avatar URLs with locally generated identicons.
+// It is safe to run on every start, once media storage is initialized.
+func MigrateRemoteAvatars() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	filter := bson.M{"avatar": bson.M{"$regex": remoteAvatarPattern}}
+	cursor, err := database.Users.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1, "avatar": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var user User
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+
+		mediaID, err := media.StoreIdenticon(media.KindAvatar, user.ID.Hex())
+		if err != nil {
+			return err
+		}
+
+		// Keep an avatar the user changed in the meantime
+		result, err := database.Users.UpdateOne(
+			ctx,
+			bson.M{"_id": user.ID, "avatar": user.Avatar},
+			bson.M{"$set": bson.M{
+				"avatar":       media.URL(media.KindAvatar, mediaID, media.DefaultSize),
+				"avatar_media": mediaID,
+			}},
+		)
+		if err != nil || result.MatchedCount == 0 {
+			media.Delete(media.KindAvatar, mediaID)
+		}
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount > 0 {
+			migrated++
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	if migrated > 0 {
+		log.Printf("Replaced the DiceBear avatars of %d users with identicons", migrated)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// sessionTouchInterval limits how often last_used_at is written
+const sessionTouchInterval = time.Minute
+
+// Session represents a single login of a user on a device
+type Session struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"user_id" json:"-"`
+	UserAgent  string             `bson:"user_agent" json:"user_agent"`
+	IP         string             `bson:"ip" json:"ip"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	LastUsedAt time.Time          `bson:"last_used_at" json:"last_used_at"`
+	ExpiresAt  time.Time          `bson:"expires_at" json:"expires_at"`
+	CSRFToken  string             `bson:"csrf_token,omitempty" json:"-"` // Must accompany unsafe cookie-authenticated requests
+	Current    bool               `bson:"-" json:"current"`
+}
+
+// CreateSession creates a new session
+func CreateSession(session *Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session.CreatedAt = time.Now()
+	session.LastUsedAt = time.Now()
+
+	csrfToken, err := NewRandomToken(32)
+	if err != nil {
+		return err
+	}
+	session.CSRFToken = csrfToken
+
+	result, err := database.Sessions.InsertOne(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	session.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// FindSessionByID finds an active session by ID
+func FindSessionByID(id primitive.ObjectID) (*Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var session Session
+	err := database.Sessions.FindOne(ctx, bson.M{
+		"_id":        id,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetUserSessions gets all active sessions for a user, most recently used first
+func GetUserSessions(userID primitive.ObjectID) ([]Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"last_used_at": -1})
+	cursor, err := database.Sessions.Find(ctx, bson.M{
+		"user_id":    userID,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// EnsureSessionCSRFToken returns the session's CSRF token, creating one for sessions that predate them
+func EnsureSessionCSRFToken(session *Session) (string, error) {
+	if session.CSRFToken != "" {
+		return session.CSRFToken, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	csrfToken, err := NewRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = database.Sessions.UpdateOne(
+		ctx,
+		bson.M{"_id": session.ID},
+		bson.M{"$set": bson.M{"csrf_token": csrfToken}},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	session.CSRFToken = csrfToken
+	return csrfToken, nil
+}
+
+// TouchSession updates the session's last used timestamp, at most once per interval
+func TouchSession(session *Session) error {
+	if time.Since(session.LastUsedAt) < sessionTouchInterval {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Sessions.UpdateOne(
+		ctx,
+		bson.M{"_id": session.ID},
+		bson.M{"$set": bson.M{"last_used_at": time.Now()}},
+	)
+	return err
+}
+
+// RevokeSession revokes a single session belonging to a user
+func RevokeSession(userID, sessionID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.Sessions.DeleteOne(ctx, bson.M{
+		"_id":     sessionID,
+		"user_id": userID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// RevokeOtherSessions revokes every session of a user except the given one and returns their IDs
+func RevokeOtherSessions(userID, keepSessionID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"user_id": userID,
+		"_id":     bson.M{"$ne": keepSessionID},
+	}
+	cursor, err := database.Sessions.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []Session
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	// Only the listed sessions, so every revoked session is reported
+	if _, err := database.Sessions.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// RevokeAllSessions revokes every session of a user
+func RevokeAllSessions(userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Sessions.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
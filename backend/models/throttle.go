@@ -0,0 +1,138 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Throttle counts attempts at a rate-limited action, such as logging in, for one key
+type Throttle struct {
+	Key         string    `bson:"_id"`      // e.g. "account:alice@example.com", "ip:203.0.113.7" or "prekeys:<user>:<target>"
+	Failures    int       `bson:"failures"` // Attempts counted in the current window
+	Lockouts    int       `bson:"lockouts"`
+	Refused     int       `bson:"refused"` // Attempts refused during the current lockout
+	LockedUntil time.Time `bson:"locked_until"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+// ThrottlePolicy describes when and for how long a key gets locked
+type ThrottlePolicy struct {
+	MaxAttempts int
+	Window      time.Duration
+	Lockout     time.Duration
+	MaxLockout  time.Duration
+}
+
+// ThrottleRetryAfter returns how long a key is still locked out, or zero
+func ThrottleRetryAfter(key string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var throttle Throttle
+	err := database.Throttles.FindOne(ctx, bson.M{"_id": key}).Decode(&throttle)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if remaining := time.Until(throttle.LockedUntil); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+// RecordThrottleHit counts an attempt against a key, and locks the key once more than
+// policy.MaxAttempts are counted within the window. Callers count login attempts before knowing
+// whether they fail, so that parallel guesses can't get past the limit. Nothing is counted while the key is locked. It returns how long the key is
+// locked out, if at all, and whether this attempt triggered the lockout.
+func RecordThrottleHit(key string, policy ThrottlePolicy) (time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	fresh := bson.M{"$gt": bson.A{"$expires_at", now}}
+	unlocked := bson.M{"$lte": bson.A{"$locked_until", now}}
+
+	// Each lockout doubles the last one, up to policy.MaxLockout
+	lockout := bson.M{"$min": bson.A{
+		bson.M{"$multiply": bson.A{
+			policy.Lockout.Milliseconds(),
+			bson.M{"$pow": bson.A{2, bson.M{"$min": bson.A{"$lockouts", 30}}}},
+		}},
+		policy.MaxLockout.Milliseconds(),
+	}}
+
+	// The check, the count and the lock are one update, so each burst locks the key only once
+	pipeline := mongo.Pipeline{
+		// Forget state the TTL monitor hasn't removed yet
+		{{Key: "$set", Value: bson.M{
+			"failures":     bson.M{"$cond": bson.A{fresh, bson.M{"$ifNull": bson.A{"$failures", 0}}, 0}},
+			"lockouts":     bson.M{"$cond": bson.A{fresh, bson.M{"$ifNull": bson.A{"$lockouts", 0}}, 0}},
+			"refused":      bson.M{"$cond": bson.A{fresh, bson.M{"$ifNull": bson.A{"$refused", 0}}, 0}},
+			"locked_until": bson.M{"$cond": bson.A{fresh, "$locked_until", time.Time{}}},
+			"expires_at":   bson.M{"$cond": bson.A{fresh, "$expires_at", now}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"failures":   bson.M{"$cond": bson.A{unlocked, bson.M{"$add": bson.A{"$failures", 1}}, "$failures"}},
+			"refused":    bson.M{"$cond": bson.A{unlocked, "$refused", bson.M{"$add": bson.A{"$refused", 1}}}},
+			"expires_at": bson.M{"$cond": bson.A{unlocked, bson.M{"$max": bson.A{"$expires_at", now.Add(policy.Window)}}, "$expires_at"}},
+		}}},
+		{{Key: "$replaceWith", Value: bson.M{"$mergeObjects": bson.A{"$$ROOT", bson.M{"$cond": bson.A{
+			bson.M{"$and": bson.A{unlocked, bson.M{"$gt": bson.A{"$failures", policy.MaxAttempts}}}},
+			bson.M{
+				"failures":     0,
+				"refused":      0,
+				"lockouts":     bson.M{"$add": bson.A{"$lockouts", 1}},
+				"locked_until": bson.M{"$add": bson.A{now, lockout}},
+				"expires_at":   bson.M{"$add": bson.A{now, lockout, policy.MaxLockout.Milliseconds()}},
+			},
+			bson.M{},
+		}}}}}},
+	}
+
+	var throttle Throttle
+	err := database.Throttles.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": key},
+		pipeline,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&throttle)
+	if err != nil {
+		return 0, false, err
+	}
+
+	remaining := time.Until(throttle.LockedUntil)
+	if remaining <= 0 {
+		return 0, false, nil
+	}
+	return remaining, throttle.Refused == 0, nil
+}
+
+// ForgiveThrottleHit takes back an attempt counted against a key that turned out to succeed
+func ForgiveThrottleHit(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Throttles.UpdateOne(
+		ctx,
+		bson.M{"_id": key, "failures": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"failures": -1}},
+	)
+	return err
+}
+
+// ResetThrottle clears the attempts and lockouts counted for a key
+func ResetThrottle(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Throttles.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,315 @@
+package models
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// Accept codes from one step before and after the current one
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+
+	// TwoFactorChallengeTTL is how long a pending 2FA login stays valid
+	TwoFactorChallengeTTL = 5 * time.Minute
+	// TwoFactorMaxAttempts is how many codes may be tried per challenge
+	TwoFactorMaxAttempts = 5
+)
+
+// TwoFactor holds TOTP settings for a user
+type TwoFactor struct {
+	Enabled       bool       `bson:"enabled" json:"enabled"`
+	Secret        string     `bson:"secret,omitempty" json:"-"`
+	PendingSecret string     `bson:"pending_secret,omitempty" json:"-"`
+	RecoveryCodes []string   `bson:"recovery_codes,omitempty" json:"-"` // SHA-256 hashes
+	LastUsedStep  int64      `bson:"last_used_step,omitempty" json:"-"`
+	EnabledAt     *time.Time `bson:"enabled_at,omitempty" json:"enabled_at,omitempty"`
+}
+
+// TwoFactorChallenge is a login that passed the password check and awaits a code
+type TwoFactorChallenge struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	TokenHash  string             `bson:"token_hash"`
+	UserID     primitive.ObjectID `bson:"user_id"`
+	RememberMe bool               `bson:"remember_me"`
+	Attempts   int                `bson:"attempts"`
+	ExpiresAt  time.Time          `bson:"expires_at"`
+}
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret creates a new random base32 TOTP secret
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPProvisioningURI builds the otpauth:// URI used by authenticator apps
+func TOTPProvisioningURI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+
+	// Authenticator apps expect %20 rather than + for spaces
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(params.Encode(), "+", "%20")
+}
+
+// totpCode computes the TOTP code for a secret at a time step (RFC 6238)
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// MatchTOTP returns the time step a code is valid for, or -1 if it doesn't match
+func MatchTOTP(secret, code string) int64 {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return -1
+	}
+
+	current := time.Now().Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return -1
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return -1
+}
+
+// GenerateRecoveryCodes creates single-use recovery codes and their hashes
+func GenerateRecoveryCodes() ([]string, []string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+		hashes[i] = HashToken(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// SetPendingTOTPSecret stores a secret awaiting confirmation
+func SetPendingTOTPSecret(userID primitive.ObjectID, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"two_factor.pending_secret": secret}},
+	)
+	return err
+}
+
+// EnableTwoFactor promotes the pending secret and stores recovery code hashes
+func EnableTwoFactor(userID primitive.ObjectID, secret string, step int64, recoveryHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"two_factor": TwoFactor{
+			Enabled:       true,
+			Secret:        secret,
+			RecoveryCodes: recoveryHashes,
+			LastUsedStep:  step,
+			EnabledAt:     ptrTime(time.Now()),
+		}}},
+	)
+	return err
+}
+
+// DisableTwoFactor removes all 2FA settings from a user
+func DisableTwoFactor(userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$unset": bson.M{"two_factor": ""}},
+	)
+	return err
+}
+
+// ReplaceRecoveryCodes swaps the user's recovery codes for new ones
+func ReplaceRecoveryCodes(userID primitive.ObjectID, recoveryHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"two_factor.recovery_codes": recoveryHashes}},
+	)
+	return err
+}
+
+// consumeTOTPStep records a used time step so a code can't be replayed
+func consumeTOTPStep(userID primitive.ObjectID, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{
+			"_id": userID,
+			"$or": bson.A{
+				bson.M{"two_factor.last_used_step": bson.M{"$lt": step}},
+				bson.M{"two_factor.last_used_step": bson.M{"$exists": false}},
+			},
+		},
+		bson.M{"$set": bson.M{"two_factor.last_used_step": step}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// consumeRecoveryCode removes a recovery code if the user has it
+func consumeRecoveryCode(userID primitive.ObjectID, code string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hash := HashToken(strings.ToLower(strings.TrimSpace(code)))
+	result, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID, "two_factor.recovery_codes": hash},
+		bson.M{"$pull": bson.M{"two_factor.recovery_codes": hash}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// VerifyTwoFactorCode checks a TOTP or recovery code for a user with 2FA enabled
+func VerifyTwoFactorCode(user *User, code string, allowRecovery bool) (bool, error) {
+	if !user.TwoFactor.Enabled {
+		return false, nil
+	}
+
+	if step := MatchTOTP(user.TwoFactor.Secret, code); step >= 0 {
+		return consumeTOTPStep(user.ID, step)
+	}
+
+	if allowRecovery && strings.Contains(code, "-") {
+		return consumeRecoveryCode(user.ID, code)
+	}
+
+	return false, nil
+}
+
+// CreateTwoFactorChallenge starts a pending 2FA login and returns its token
+func CreateTwoFactorChallenge(userID primitive.ObjectID, rememberMe bool) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token, err := NewRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = database.TwoFactorChallenges.InsertOne(ctx, TwoFactorChallenge{
+		TokenHash:  HashToken(token),
+		UserID:     userID,
+		RememberMe: rememberMe,
+		ExpiresAt:  time.Now().Add(TwoFactorChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// UseTwoFactorAttempt counts an attempt against an unexpired challenge and returns it, or nil
+// once it is used up. The check and the count are one update, so concurrent guesses can't
+// exceed TwoFactorMaxAttempts.
+func UseTwoFactorAttempt(token string) (*TwoFactorChallenge, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var challenge TwoFactorChallenge
+	err := database.TwoFactorChallenges.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"token_hash": HashToken(token),
+			"expires_at": bson.M{"$gt": time.Now()},
+			"attempts":   bson.M{"$lt": TwoFactorMaxAttempts},
+		},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&challenge)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// DeleteTwoFactorChallenge removes a challenge once it is used up
+func DeleteTwoFactorChallenge(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.TwoFactorChallenges.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func ptrTime(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,31 @@
+package models
+
+import "testing"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// Appendix B SHA-1 vectors; the seed is the ASCII string "12345678901234567890".
+	// The RFC lists 8-digit codes, of which the last 6 are ours.
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := totpCode(secret, tt.unix/totpPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/vinneth/go-webchat/config"
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// uniqueIDAlphabet leaves out characters that are easily confused: 0, 1, I, L, O and U
+const uniqueIDAlphabet = "23456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+const (
+	// minUniqueIDLength keeps the random part large enough that IDs can't be enumerated
+	minUniqueIDLength = 4
+	// maxUniqueIDAttempts bounds how often a colliding generated ID is replaced
+	maxUniqueIDAttempts = 5
+)
+
+// ErrUniqueIDExhausted is returned when no free unique ID was found within the retry limit
+var ErrUniqueIDExhausted = errors.New("could not allocate a free unique ID")
+
+var uniqueIDPrefixPattern = regexp.MustCompile(`^[A-Z0-9]+$`)
+
+// CheckUniqueIDConfig validates the configured unique ID format
+func CheckUniqueIDConfig() error {
+	prefixes := config.AppConfig.UniqueIDPrefixes
+	if len(prefixes) == 0 {
+		return errors.New("UNIQUE_ID_PREFIXES must list at least one prefix")
+	}
+	if config.AppConfig.UniqueIDLength < minUniqueIDLength {
+		return fmt.Errorf("UNIQUE_ID_LENGTH must be at least %d", minUniqueIDLength)
+	}
+
+	for _, prefix := range prefixes {
+		prefix = strings.ToUpper(prefix)
+		if !uniqueIDPrefixPattern.MatchString(prefix) {
+			return fmt.Errorf("invalid unique ID prefix %q", prefix)
+		}
+		sample := "#" + prefix + "-" + strings.Repeat("A", config.AppConfig.UniqueIDLength)
+		if !ValidUniqueID(sample) {
+			return fmt.Errorf("unique IDs with prefix %q and %d characters are too long", prefix, config.AppConfig.UniqueIDLength)
+		}
+	}
+	return nil
+}
+
+// GenerateUniqueID creates a random unique ID like #WAVE-7K3QX9. It doesn't check
+// whether the ID is free; CreateUser retries when the insert hits the unique index.
+func GenerateUniqueID() (string, error) {
+	prefixes := config.AppConfig.UniqueIDPrefixes
+
+	prefixIdx, err := rand.Int(rand.Reader, big.NewInt(int64(len(prefixes))))
+	if err != nil {
+		return "", err
+	}
+
+	suffix := make([]byte, config.AppConfig.UniqueIDLength)
+	alphabetSize := big.NewInt(int64(len(uniqueIDAlphabet)))
+	for i := range suffix {
+		idx, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		suffix[i] = uniqueIDAlphabet[idx.Int64()]
+	}
+
+	return "#" + strings.ToUpper(prefixes[prefixIdx.Int64()]) + "-" + string(suffix), nil
+}
+
+// MigrateDuplicateUniqueIDs gives a fresh unique ID to every user sharing one with an older account,
+// and to users without one, so the unique index on unique_id can be created. Affected users may
+// choose their ID again. It is safe to run on every start.
+func MigrateDuplicateUniqueIDs() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	pipeline := bson.A{
+		bson.M{"$sort": bson.M{"_id": 1}},
+		bson.M{"$group": bson.M{
+			"_id":   bson.M{"$ifNull": bson.A{"$unique_id", ""}},
+			"users": bson.M{"$push": "$_id"},
+		}},
+		bson.M{"$match": bson.M{"$or": bson.A{
+			bson.M{"users.1": bson.M{"$exists": true}},
+			bson.M{"_id": ""},
+		}}},
+	}
+	cursor, err := database.Users.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var duplicate struct {
+			UniqueID string               `bson:"_id"`
+			Users    []primitive.ObjectID `bson:"users"`
+		}
+		if err := cursor.Decode(&duplicate); err != nil {
+			return err
+		}
+
+		// The oldest account keeps the ID
+		users := duplicate.Users
+		if duplicate.UniqueID != "" {
+			users = users[1:]
+		}
+		for _, userID := range users {
+			uniqueID, err := freeUniqueID(ctx)
+			if err != nil {
+				return err
+			}
+			_, err = database.Users.UpdateOne(
+				ctx,
+				bson.M{"_id": userID},
+				bson.M{"$set": bson.M{"unique_id": uniqueID, "unique_id_changed": false}},
+			)
+			if err != nil {
+				return err
+			}
+			migrated++
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	if migrated > 0 {
+		log.Printf("Assigned new unique IDs to %d users with duplicate or missing IDs", migrated)
+	}
+	return nil
+}
+
+// freeUniqueID generates a unique ID no user has yet. Only used while the unique index may be missing.
+func freeUniqueID(ctx context.Context) (string, error) {
+	for attempt := 1; ; attempt++ {
+		uniqueID, err := GenerateUniqueID()
+		if err != nil {
+			return "", err
+		}
+		count, err := database.Users.CountDocuments(ctx, bson.M{"unique_id": uniqueID})
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return uniqueID, nil
+		}
+		if attempt >= maxUniqueIDAttempts {
+			return "", ErrUniqueIDExhausted
+		}
+	}
+}
+
+// isDuplicateUniqueID reports whether an insert or update failed because the unique ID is taken
+func isDuplicateUniqueID(err error) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "unique_id")
+}
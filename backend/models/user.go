@@ -2,12 +2,11 @@ package models
 
 import (
 	"context"
-	"crypto/rand"
-	"fmt"
-	"math/big"
+	"log"
 	"time"
 
 	"github.com/vinneth/go-webchat/database"
+	"github.com/vinneth/go-webchat/media"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -19,13 +18,28 @@ type User struct {
 	UniqueID        string               `bson:"unique_id" json:"unique_id"`
 	UniqueIDChanged bool                 `bson:"unique_id_changed" json:"unique_id_changed"`
 	Email           string               `bson:"email" json:"email"`
+	EmailVerified   bool                 `bson:"email_verified" json:"email_verified"`
 	PasswordHash    string               `bson:"password_hash,omitempty" json:"-"`
 	Name            string               `bson:"name" json:"name"`
+	NameSearch      []string             `bson:"name_search,omitempty" json:"-"` // See NameSearchKeys
 	Avatar          string               `bson:"avatar" json:"avatar"`
-	AuthProvider    string               `bson:"auth_provider" json:"auth_provider"` // "local" or "google"
-	Contacts        []primitive.ObjectID `bson:"contacts" json:"contacts"`
+	AvatarMedia     string               `bson:"avatar_media,omitempty" json:"-"` // Media ID when the avatar is stored locally
+	Bio             string               `bson:"bio,omitempty" json:"bio,omitempty"`
+	AuthProvider    string               `bson:"auth_provider" json:"auth_provider"` // Provider the account was created with
+	Identities      []Identity           `bson:"identities,omitempty" json:"identities"`
+	Contacts        []ContactEntry       `bson:"contacts" json:"-"` // Annotations are private to the user
+	ContactLists    []ContactList        `bson:"contact_lists,omitempty" json:"-"`
+	Blocked         []primitive.ObjectID `bson:"blocked,omitempty" json:"-"` // Users this user has blocked
+	Privacy         PrivacySettings      `bson:"privacy,omitempty" json:"privacy"`
+	TwoFactor       TwoFactor            `bson:"two_factor,omitempty" json:"two_factor"`
+	IsBot           bool                 `bson:"is_bot,omitempty" json:"is_bot"`
+	BotOwnerID      primitive.ObjectID   `bson:"bot_owner_id,omitempty" json:"bot_owner_id,omitempty"` // User who manages the bot
 	CreatedAt       time.Time            `bson:"created_at" json:"created_at"`
 	LastSeen        time.Time            `bson:"last_seen" json:"last_seen"`
+	DeletionAt      *time.Time           `bson:"deletion_at,omitempty" json:"deletion_at,omitempty"` // Scheduled account deletion
+	Deleted         bool                 `bson:"deleted,omitempty" json:"-"`                         // Anonymized after deletion
+	Role            string               `bson:"role,omitempty" json:"role,omitempty"`               // Server-wide role, e.g. RoleAdmin
+	Suspension      *Suspension          `bson:"suspension,omitempty" json:"suspension,omitempty"`
 }
 
 type UserPublic struct {
@@ -33,38 +47,11 @@ type UserPublic struct {
 	UniqueID string             `json:"unique_id"`
 	Name     string             `json:"name"`
 	Avatar   string             `json:"avatar"`
-	LastSeen time.Time          `json:"last_seen"`
+	Bio      string             `json:"bio,omitempty"`
+	Nickname string             `json:"nickname,omitempty"`  // Given by the viewer, when they have the user as a contact
+	LastSeen *time.Time         `json:"last_seen,omitempty"` // Hidden from users they have blocked
 	IsOnline bool               `json:"is_online"`
-}
-
-// GenerateUniqueID creates a unique ID like #GOPRO-882
-func GenerateUniqueID() (string, error) {
-	prefixes := []string{"CHAT", "USER", "TALK", "GOPRO", "WAVE", "PING"}
-	
-	// Random prefix
-	prefixIdx, err := rand.Int(rand.Reader, big.NewInt(int64(len(prefixes))))
-	if err != nil {
-		return "", err
-	}
-	prefix := prefixes[prefixIdx.Int64()]
-	
-	// Random 3-digit number
-	num, err := rand.Int(rand.Reader, big.NewInt(900))
-	if err != nil {
-		return "", err
-	}
-	number := num.Int64() + 100 // 100-999
-	
-	uniqueID := fmt.Sprintf("#%s-%d", prefix, number)
-	
-	// Check if exists, regenerate if needed
-	ctx := context.Background()
-	count, _ := database.Users.CountDocuments(ctx, bson.M{"unique_id": uniqueID})
-	if count > 0 {
-		return GenerateUniqueID() // Recurse to generate new one
-	}
-	
-	return uniqueID, nil
+	IsBot    bool               `json:"is_bot,omitempty"`
 }
 
 // HashPassword hashes a password using bcrypt
@@ -84,25 +71,61 @@ func CreateUser(user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	user.ID = primitive.NewObjectID()
 	user.CreatedAt = time.Now()
 	user.LastSeen = time.Now()
-	user.Contacts = []primitive.ObjectID{}
+	user.Contacts = []ContactEntry{}
+	user.NameSearch = NameSearchKeys(user.Name)
 
-	if user.UniqueID == "" {
-		uniqueID, err := GenerateUniqueID()
+	// Default to a locally generated identicon
+	if user.Avatar == "" {
+		mediaID, err := media.StoreIdenticon(media.KindAvatar, user.ID.Hex())
 		if err != nil {
 			return err
 		}
-		user.UniqueID = uniqueID
-	}
+		user.Avatar = media.URL(media.KindAvatar, mediaID, media.DefaultSize)
+		user.AvatarMedia = mediaID
 
-	result, err := database.Users.InsertOne(ctx, user)
-	if err != nil {
-		return err
+		// Don't leave the image behind if the user is never created
+		if err := insertUser(ctx, user); err != nil {
+			media.Delete(media.KindAvatar, mediaID)
+			user.Avatar, user.AvatarMedia = "", ""
+			return err
+		}
+		return nil
 	}
 
-	user.ID = result.InsertedID.(primitive.ObjectID)
-	return nil
+	return insertUser(ctx, user)
+}
+
+// insertUser inserts a new user, generating a unique ID if it has none
+func insertUser(ctx context.Context, user *User) error {
+	// Uniqueness is enforced by the unique index; a generated ID that is
+	// already taken is replaced and the insert retried
+	generated := user.UniqueID == ""
+	for attempt := 1; ; attempt++ {
+		if generated {
+			uniqueID, err := GenerateUniqueID()
+			if err != nil {
+				return err
+			}
+			user.UniqueID = uniqueID
+		}
+
+		_, err := database.Users.InsertOne(ctx, user)
+		if err == nil {
+			return nil
+		}
+		if !isDuplicateUniqueID(err) {
+			return err
+		}
+		if !generated {
+			return ErrUniqueIDTaken
+		}
+		if attempt >= maxUniqueIDAttempts {
+			return ErrUniqueIDExhausted
+		}
+	}
 }
 
 // FindUserByEmail finds a user by email
@@ -143,7 +166,7 @@ func FindUserByUniqueID(uniqueID string) (*User, error) {
 	defer cancel()
 
 	var user User
-	err := database.Users.FindOne(ctx, bson.M{"unique_id": uniqueID}).Decode(&user)
+	err := database.Users.FindOne(ctx, bson.M{"unique_id": uniqueID, "deleted": bson.M{"$ne": true}}).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, nil
@@ -166,6 +189,57 @@ func UpdateLastSeen(userID primitive.ObjectID) error {
 	return err
 }
 
+// MarkEmailVerified marks the user's email as verified, if it is still the given address
+func MarkEmailVerified(userID primitive.ObjectID, email string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID, "email": email},
+		bson.M{"$set": bson.M{"email_verified": true}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// MigrateEmailVerification marks accounts from before email verification as verified, so that
+// enabling REQUIRE_EMAIL_VERIFICATION doesn't lock them out. OAuth addresses were already vouched
+// for by the provider; local accounts are grandfathered in. It is safe to run on every start.
+func MigrateEmailVerification() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	// Accounts created since always store email_verified, even when false
+	result, err := database.Users.UpdateMany(
+		ctx,
+		bson.M{"email_verified": bson.M{"$exists": false}, "is_bot": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"email_verified": true}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Marked the email of %d existing users as verified", result.ModifiedCount)
+	}
+	return nil
+}
+
+// UpdatePassword replaces the user's password hash
+func UpdatePassword(userID primitive.ObjectID, passwordHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.Users.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"password_hash": passwordHash}},
+	)
+	return err
+}
+
 // AddContact adds a contact to user's contact list
 func AddContact(userID, contactID primitive.ObjectID) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -173,8 +247,8 @@ func AddContact(userID, contactID primitive.ObjectID) error {
 
 	_, err := database.Users.UpdateOne(
 		ctx,
-		bson.M{"_id": userID},
-		bson.M{"$addToSet": bson.M{"contacts": contactID}},
+		bson.M{"_id": userID, "contacts.user_id": bson.M{"$ne": contactID}},
+		bson.M{"$push": bson.M{"contacts": ContactEntry{UserID: contactID, AddedAt: time.Now()}}},
 	)
 	return err
 }
@@ -187,7 +261,7 @@ func RemoveContact(userID, contactID primitive.ObjectID) error {
 	_, err := database.Users.UpdateOne(
 		ctx,
 		bson.M{"_id": userID},
-		bson.M{"$pull": bson.M{"contacts": contactID}},
+		bson.M{"$pull": bson.M{"contacts": bson.M{"user_id": contactID}}},
 	)
 	return err
 }
@@ -206,7 +280,7 @@ func GetContacts(userID primitive.ObjectID) ([]User, error) {
 		return []User{}, nil
 	}
 
-	cursor, err := database.Users.Find(ctx, bson.M{"_id": bson.M{"$in": user.Contacts}})
+	cursor, err := database.Users.Find(ctx, bson.M{"_id": bson.M{"$in": user.ContactIDs()}})
 	if err != nil {
 		return nil, err
 	}
@@ -222,12 +296,37 @@ func GetContacts(userID primitive.ObjectID) ([]User, error) {
 
 // ToPublic converts User to UserPublic (safe for client)
 func (u *User) ToPublic(isOnline bool) UserPublic {
+	lastSeen := u.LastSeen
 	return UserPublic{
 		ID:       u.ID,
 		UniqueID: u.UniqueID,
 		Name:     u.Name,
 		Avatar:   u.Avatar,
-		LastSeen: u.LastSeen,
+		Bio:      u.Bio,
+		LastSeen: &lastSeen,
 		IsOnline: isOnline,
+		IsBot:    u.IsBot,
+	}
+}
+
+// ToPublicFor converts User to UserPublic as seen by viewerID,
+// hiding presence from users they have blocked and whatever their privacy settings hide
+func (u *User) ToPublicFor(viewerID primitive.ObjectID, isOnline bool) UserPublic {
+	public := u.ToPublic(isOnline)
+	if u.HasBlocked(viewerID) {
+		public.LastSeen = nil
+		public.IsOnline = false
+	}
+
+	privacy := u.Privacy.WithDefaults()
+	if !u.visibleTo(privacy.LastSeen, viewerID) {
+		public.LastSeen = nil
+	}
+	if !u.visibleTo(privacy.Online, viewerID) {
+		public.IsOnline = false
+	}
+	if !u.visibleTo(privacy.ProfilePhoto, viewerID) {
+		public.Avatar = ""
 	}
+	return public
 }
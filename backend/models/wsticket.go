@@ -0,0 +1,67 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/vinneth/go-webchat/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// WSTicketTTL is how long a WebSocket ticket can be redeemed
+const WSTicketTTL = 30 * time.Second
+
+// WSTicket is a single-use credential for opening a WebSocket connection
+type WSTicket struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	TokenHash string             `bson:"token_hash"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	SessionID primitive.ObjectID `bson:"session_id"`
+	Origin    string             `bson:"origin"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+}
+
+// CreateWSTicket issues a ticket for a user's session, valid only from the given origin
+func CreateWSTicket(userID, sessionID primitive.ObjectID, origin string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token, err := NewRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = database.WSTickets.InsertOne(ctx, WSTicket{
+		TokenHash: HashToken(token),
+		UserID:    userID,
+		SessionID: sessionID,
+		Origin:    origin,
+		ExpiresAt: time.Now().Add(WSTicketTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RedeemWSTicket consumes an unexpired ticket issued for the origin; a ticket can only be redeemed once
+func RedeemWSTicket(token, origin string) (*WSTicket, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var ticket WSTicket
+	err := database.WSTickets.FindOneAndDelete(ctx, bson.M{
+		"token_hash": HashToken(token),
+		"origin":     origin,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&ticket)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &ticket, nil
+}
@@ -0,0 +1,252 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vinneth/go-webchat/config"
+	"golang.org/x/oauth2"
+)
+
+// httpClient is used for discovery, token exchange and userinfo requests
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// UserInfo is the identity returned by a provider after sign-in
+type UserInfo struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// Provider is a configured OAuth 2.0 / OpenID Connect sign-in provider
+type Provider struct {
+	Name string
+
+	cfg         config.OAuthProviderConfig
+	mu          sync.Mutex
+	oauthConfig *oauth2.Config
+	userInfoURL string
+}
+
+// discoveryDocument holds the fields we use from /.well-known/openid-configuration
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// NewProvider creates a provider; endpoints are resolved lazily on first use
+func NewProvider(cfg config.OAuthProviderConfig) *Provider {
+	return &Provider{Name: cfg.Name, cfg: cfg}
+}
+
+// config returns the oauth2 configuration, running OIDC discovery if needed
+func (p *Provider) config(ctx context.Context) (*oauth2.Config, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauthConfig != nil {
+		return p.oauthConfig, p.userInfoURL, nil
+	}
+
+	authURL, tokenURL, userInfoURL := p.cfg.AuthURL, p.cfg.TokenURL, p.cfg.UserInfoURL
+	if p.cfg.Issuer != "" && (authURL == "" || tokenURL == "" || userInfoURL == "") {
+		doc, err := discover(ctx, p.cfg.Issuer)
+		if err != nil {
+			return nil, "", err
+		}
+		if authURL == "" {
+			authURL = doc.AuthorizationEndpoint
+		}
+		if tokenURL == "" {
+			tokenURL = doc.TokenEndpoint
+		}
+		if userInfoURL == "" {
+			userInfoURL = doc.UserInfoEndpoint
+		}
+	}
+
+	if authURL == "" || tokenURL == "" || userInfoURL == "" {
+		return nil, "", fmt.Errorf("oauth provider %q is missing endpoints", p.Name)
+	}
+
+	p.oauthConfig = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       p.cfg.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  authURL,
+			TokenURL: tokenURL,
+		},
+	}
+	p.userInfoURL = userInfoURL
+	return p.oauthConfig, p.userInfoURL, nil
+}
+
+// discover fetches the provider's OpenID Connect discovery document
+func discover(ctx context.Context, issuer string) (*discoveryDocument, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc discovery for %s failed: %s", issuer, resp.Status)
+	}
+
+	var doc discoveryDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(doc.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("oidc discovery issuer mismatch: got %q, want %q", doc.Issuer, issuer)
+	}
+
+	return &doc, nil
+}
+
+// AuthCodeURL returns the URL to redirect the user to, bound to state and a PKCE verifier
+func (p *Provider) AuthCodeURL(ctx context.Context, state, verifier string) (string, error) {
+	oauthConfig, _, err := p.config(ctx)
+	if err != nil {
+		return "", err
+	}
+	return oauthConfig.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange trades an authorization code for the signed-in user's identity
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (*UserInfo, error) {
+	oauthConfig, userInfoURL, err := p.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+
+	client := oauthConfig.Client(ctx, token)
+
+	var claims map[string]interface{}
+	if err := getJSON(client, userInfoURL, &claims); err != nil {
+		return nil, fmt.Errorf("userinfo request failed: %w", err)
+	}
+
+	info := parseUserInfo(claims)
+	if info.Subject == "" {
+		return nil, errors.New("userinfo response has no subject")
+	}
+
+	// GitHub leaves email_verified out of userinfo and often the email too
+	if p.cfg.EmailsURL != "" && !info.EmailVerified {
+		var emails []providerEmail
+		if err := getJSON(client, p.cfg.EmailsURL, &emails); err != nil {
+			return nil, fmt.Errorf("emails request failed: %w", err)
+		}
+		if email := primaryVerifiedEmail(emails); email != "" {
+			info.Email = email
+			info.EmailVerified = true
+		}
+	}
+
+	return info, nil
+}
+
+// providerEmail is an entry of a GitHub-style list of the user's email addresses
+type providerEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// primaryVerifiedEmail picks the primary address if it is verified, or else any verified address
+func primaryVerifiedEmail(emails []providerEmail) string {
+	fallback := ""
+	for _, email := range emails {
+		if !email.Verified || email.Email == "" {
+			continue
+		}
+		if email.Primary {
+			return email.Email
+		}
+		if fallback == "" {
+			fallback = email.Email
+		}
+	}
+	return fallback
+}
+
+// getJSON fetches a URL with an authorized client and decodes the JSON response
+func getJSON(client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// parseUserInfo reads standard OIDC claims, falling back to common non-OIDC names (e.g. GitHub)
+func parseUserInfo(claims map[string]interface{}) *UserInfo {
+	info := &UserInfo{
+		Subject: firstClaim(claims, "sub", "id"),
+		Email:   firstClaim(claims, "email"),
+		Name:    firstClaim(claims, "name", "preferred_username", "login"),
+		Picture: firstClaim(claims, "picture", "avatar_url"),
+	}
+
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		info.EmailVerified = verified
+	case string:
+		info.EmailVerified = verified == "true"
+	}
+
+	return info
+}
+
+// firstClaim returns the first non-empty claim among keys as a string
+func firstClaim(claims map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch value := claims[key].(type) {
+		case string:
+			if value != "" {
+				return value
+			}
+		case float64:
+			return fmt.Sprintf("%.0f", value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vinneth/go-webchat/config"
+)
+
+// newGitHubServer serves a GitHub-style token endpoint, /user and /user/emails
+func newGitHubServer(t *testing.T, user, emails string) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "gh-token", "token_type": "bearer"})
+	})
+	serve := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer gh-token" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(body))
+		}
+	}
+	mux.HandleFunc("/user", serve(user))
+	mux.HandleFunc("/user/emails", serve(emails))
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestExchangeUsesPrimaryVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		name         string
+		user         string
+		emails       string
+		wantEmail    string
+		wantVerified bool
+	}{
+		{
+			name:         "no public email",
+			user:         `{"id":42,"login":"octocat","email":null}`,
+			emails:       `[{"email":"old@example.com","primary":false,"verified":true},{"email":"octo@example.com","primary":true,"verified":true}]`,
+			wantEmail:    "octo@example.com",
+			wantVerified: true,
+		},
+		{
+			name:         "public email is not the primary",
+			user:         `{"id":42,"login":"octocat","email":"public@example.com"}`,
+			emails:       `[{"email":"public@example.com","primary":false,"verified":false},{"email":"octo@example.com","primary":true,"verified":true}]`,
+			wantEmail:    "octo@example.com",
+			wantVerified: true,
+		},
+		{
+			name:         "no verified email",
+			user:         `{"id":42,"login":"octocat","email":"public@example.com"}`,
+			emails:       `[{"email":"public@example.com","primary":true,"verified":false}]`,
+			wantEmail:    "public@example.com",
+			wantVerified: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newGitHubServer(t, tt.user, tt.emails)
+			provider := NewProvider(config.OAuthProviderConfig{
+				Name:        "github",
+				ClientID:    "client",
+				AuthURL:     server.URL + "/authorize",
+				TokenURL:    server.URL + "/token",
+				UserInfoURL: server.URL + "/user",
+				EmailsURL:   server.URL + "/user/emails",
+			})
+
+			info, err := provider.Exchange(context.Background(), "code", "verifier")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Subject != "42" || info.Name != "octocat" {
+				t.Errorf("subject, name = %q, %q", info.Subject, info.Name)
+			}
+			if info.Email != tt.wantEmail || info.EmailVerified != tt.wantVerified {
+				t.Errorf("email = %q (verified %v), want %q (verified %v)",
+					info.Email, info.EmailVerified, tt.wantEmail, tt.wantVerified)
+			}
+		})
+	}
+}
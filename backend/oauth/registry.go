@@ -0,0 +1,103 @@
+package oauth
+
+import (
+	"log"
+	"sort"
+
+	"github.com/vinneth/go-webchat/config"
+)
+
+// presets fills in well-known endpoints for providers that only need credentials
+var presets = map[string]config.OAuthProviderConfig{
+	"google": {
+		Issuer: "https://accounts.google.com",
+		Scopes: []string{"openid", "email", "profile"},
+	},
+	"gitlab": {
+		Issuer: "https://gitlab.com",
+		Scopes: []string{"openid", "email", "profile"},
+	},
+	// GitHub doesn't support OpenID Connect, so its endpoints are listed explicitly
+	"github": {
+		AuthURL:     "https://github.com/login/oauth/authorize",
+		TokenURL:    "https://github.com/login/oauth/access_token",
+		UserInfoURL: "https://api.github.com/user",
+		EmailsURL:   "https://api.github.com/user/emails",
+		Scopes:      []string{"read:user", "user:email"},
+	},
+}
+
+var providers = map[string]*Provider{}
+
+// Init builds the provider registry from configuration
+func Init() {
+	cfg := config.AppConfig
+	providers = map[string]*Provider{}
+
+	// Google keeps its dedicated settings for backwards compatibility
+	if cfg.GoogleClientID != "" {
+		register(config.OAuthProviderConfig{
+			Name:         "google",
+			ClientID:     cfg.GoogleClientID,
+			ClientSecret: cfg.GoogleClientSecret,
+			RedirectURL:  cfg.GoogleRedirectURL,
+		})
+	}
+
+	for _, providerCfg := range cfg.OAuthProviders {
+		register(providerCfg)
+	}
+
+	if len(providers) > 0 {
+		log.Printf("🔑 OAuth providers: %v", Names())
+	}
+}
+
+// register applies presets and defaults, then adds the provider
+func register(providerCfg config.OAuthProviderConfig) {
+	if preset, ok := presets[providerCfg.Name]; ok {
+		if providerCfg.Issuer == "" {
+			providerCfg.Issuer = preset.Issuer
+		}
+		if providerCfg.AuthURL == "" {
+			providerCfg.AuthURL = preset.AuthURL
+		}
+		if providerCfg.TokenURL == "" {
+			providerCfg.TokenURL = preset.TokenURL
+		}
+		if providerCfg.UserInfoURL == "" {
+			providerCfg.UserInfoURL = preset.UserInfoURL
+		}
+		if providerCfg.EmailsURL == "" {
+			providerCfg.EmailsURL = preset.EmailsURL
+		}
+		if len(providerCfg.Scopes) == 0 {
+			providerCfg.Scopes = preset.Scopes
+		}
+	}
+
+	if len(providerCfg.Scopes) == 0 {
+		providerCfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if providerCfg.RedirectURL == "" {
+		providerCfg.RedirectURL = config.AppConfig.APIURL + "/api/auth/oauth/" + providerCfg.Name + "/callback"
+	}
+
+	providers[providerCfg.Name] = NewProvider(providerCfg)
+}
+
+// Get returns a configured provider by name
+func Get(name string) (*Provider, bool) {
+	provider, ok := providers[name]
+	return provider, ok
+}
+
+// Names returns the names of all configured providers
+func Names() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
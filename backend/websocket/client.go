@@ -43,63 +43,89 @@ func (c *FiberWebSocketConn) Close() error {
 	return c.Conn.Close()
 }
 
-// WebSocketUpgrade middleware to check WebSocket upgrade
+// WebSocketUpgrade middleware to check WebSocket upgrade.
+// Browsers authenticate with a one-time ticket from POST /api/ws/ticket, bots with an API key header.
 func WebSocketUpgrade() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		if websocket.IsWebSocketUpgrade(c) {
-			c.Locals("allowed", true)
+		if !websocket.IsWebSocketUpgrade(c) {
+			return fiber.ErrUpgradeRequired
+		}
+
+		// Only the frontend may open connections from a browser
+		origin := c.Get(fiber.HeaderOrigin)
+		if origin != "" && !middleware.AllowedOrigin(origin) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Origin not allowed",
+			})
+		}
+
+		if token := middleware.TokenFromRequest(c); models.IsAPIKey(token) {
+			key, err := middleware.AuthenticateAPIKey(token)
+			if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid API key",
+				})
+			}
+			if !key.HasScope(models.ScopeMessagesRead) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "API key is missing the " + models.ScopeMessagesRead + " scope",
+				})
+			}
+
+			c.Locals("userID", key.BotID)
+			c.Locals("apiKey", key)
 			return c.Next()
 		}
-		return fiber.ErrUpgradeRequired
-	}
-}
 
-// HandleWebSocket handles WebSocket connections
-func HandleWebSocket(c *websocket.Conn) {
-	// Get user ID from query or locals
-	tokenString := c.Query("token")
-	if tokenString == "" {
-		// Try from cookie
-		tokenString = c.Cookies("auth_token")
-	}
+		ticketString := c.Query("ticket")
+		if ticketString == "" || origin == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Authentication required",
+			})
+		}
 
-	if tokenString == "" {
-		c.WriteJSON(WSMessage{
-			Type: "error",
-			Payload: map[string]interface{}{
-				"message": "Authentication required",
-			},
-		})
-		c.Close()
-		return
-	}
+		ticket, err := models.RedeemWSTicket(ticketString, origin)
+		if err != nil || ticket == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired ticket",
+			})
+		}
 
-	claims, err := middleware.ValidateToken(tokenString)
-	if err != nil {
-		c.WriteJSON(WSMessage{
-			Type: "error",
-			Payload: map[string]interface{}{
-				"message": "Invalid token",
-			},
-		})
-		c.Close()
-		return
+		// The session may have been revoked since the ticket was issued
+		session, err := models.FindSessionByID(ticket.SessionID)
+		if err != nil || session == nil || session.UserID != ticket.UserID {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Session has been revoked",
+			})
+		}
+
+		c.Locals("userID", ticket.UserID)
+		c.Locals("sessionID", ticket.SessionID)
+		return c.Next()
 	}
+}
 
-	userID, err := primitive.ObjectIDFromHex(claims.UserID)
-	if err != nil {
+// HandleWebSocket handles WebSocket connections
+func HandleWebSocket(c *websocket.Conn) {
+	// Authenticated by WebSocketUpgrade
+	userID, ok := c.Locals("userID").(primitive.ObjectID)
+	if !ok {
 		c.Close()
 		return
 	}
+	apiKey, _ := c.Locals("apiKey").(*models.APIKey)
+	sessionID, _ := c.Locals("sessionID").(primitive.ObjectID)
 
 	// Create client
 	client := &Client{
-		ID:       primitive.NewObjectID(),
-		UserID:   userID,
-		Conn:     &FiberWebSocketConn{c},
-		Hub:      Hub,
-		Send:     make(chan []byte, 256),
-		LastPing: time.Now(),
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		SessionID: sessionID,
+		Conn:      &FiberWebSocketConn{c},
+		Hub:       Hub,
+		Send:      make(chan []byte, 256),
+		LastPing:  time.Now(),
+		APIKey:    apiKey,
 	}
 
 	// Register client
@@ -184,48 +210,122 @@ func (c *Client) handleMessage(msg WSMessage) {
 	}
 }
 
+// DeliverMessage stores a message from a conversation member and broadcasts it to the other members.
+// Encrypted payloads are stored and relayed as-is.
+func DeliverMessage(msg *models.Message) (*models.MessageWithSender, error) {
+	senderID, convID := msg.SenderID, msg.ConversationID
+
+	conv, err := models.FindConversationByID(convID)
+	if err != nil {
+		return nil, err
+	}
+	if err := models.CheckMessage(conv, msg); err != nil {
+		return nil, err
+	}
+
+	// No direct messages between users who blocked each other
+	if conv.Type == models.ConversationTypePrivate {
+		for _, memberID := range conv.Members {
+			if memberID == senderID {
+				continue
+			}
+			blocked, err := models.IsBlockedBetween(senderID, memberID)
+			if err != nil {
+				return nil, err
+			}
+			if blocked {
+				return nil, models.ErrBlocked
+			}
+		}
+	}
+
+	if err := models.CreateMessage(msg); err != nil {
+		return nil, err
+	}
+
+	// Get sender info
+	sender, _ := models.FindUserByID(senderID)
+	var senderPublic *models.UserPublic
+	if sender != nil {
+		public := sender.ToPublic(Hub.IsOnline(senderID))
+		senderPublic = &public
+	}
+
+	result := &models.MessageWithSender{
+		Message: *msg,
+		Sender:  senderPublic,
+	}
+
+	// Broadcast to conversation members, except those who blocked the sender,
+	// with the sender's profile as each member may see it
+	Hub.BroadcastFromUserEach(convID, senderID, func(recipientID primitive.ObjectID) WSMessage {
+		view := *result
+		if sender != nil {
+			public := sender.ToPublicFor(recipientID, Hub.IsOnline(senderID))
+			view.Sender = &public
+		}
+		return WSMessage{
+			Type: "message:new",
+			Payload: map[string]interface{}{
+				"message": view,
+			},
+		}
+	})
+
+	return result, nil
+}
+
 // handleSendMessage handles sending a new message
 func (c *Client) handleSendMessage(payload map[string]interface{}) {
 	convIDStr, ok := payload["conversation_id"].(string)
 	if !ok {
 		return
 	}
-	content, ok := payload["content"].(string)
-	if !ok || content == "" {
-		return
-	}
+	content, _ := payload["content"].(string)
+	msgType, _ := payload["type"].(string)
+	ciphertext, _ := payload["ciphertext"].(string)
+	senderDevice, _ := payload["sender_device"].(string)
 
 	convID, err := primitive.ObjectIDFromHex(convIDStr)
 	if err != nil {
 		return
 	}
 
+	// Bots need the write scope for this conversation
+	if c.APIKey != nil && (!c.APIKey.HasScope(models.ScopeMessagesWrite) || !c.APIKey.AllowsConversation(convID)) {
+		return
+	}
+
 	// Verify user is member of conversation
 	isMember, err := models.IsMember(convID, c.UserID)
 	if err != nil || !isMember {
 		return
 	}
 
-	// Create message
-	msg := &models.Message{
+	msg, err := DeliverMessage(&models.Message{
 		ConversationID: convID,
 		SenderID:       c.UserID,
+		Type:           models.MessageType(msgType),
 		Content:        content,
+		Ciphertext:     ciphertext,
+		SenderDevice:   senderDevice,
+	})
+	if err == models.ErrPlaintextInEncrypted || err == models.ErrEncryptedInPlaintext || err == models.ErrInvalidMessage || err == models.ErrBlocked {
+		// Let the sender know the message was refused
+		c.sendMessage(WSMessage{
+			Type: "message:error",
+			Payload: map[string]interface{}{
+				"temp_id": payload["temp_id"],
+				"error":   err.Error(),
+			},
+		})
+		return
 	}
-
-	if err := models.CreateMessage(msg); err != nil {
+	if err != nil {
 		log.Printf("Failed to create message: %v", err)
 		return
 	}
 
-	// Get sender info
-	sender, _ := models.FindUserByID(c.UserID)
-	var senderPublic *models.UserPublic
-	if sender != nil {
-		public := sender.ToPublic(true)
-		senderPublic = &public
-	}
-
 	// Send confirmation to sender
 	c.sendMessage(WSMessage{
 		Type: "message:sent",
@@ -235,17 +335,6 @@ func (c *Client) handleSendMessage(payload map[string]interface{}) {
 			"status":     "sent",
 		},
 	})
-
-	// Broadcast to conversation members
-	Hub.BroadcastToConversation(convID, WSMessage{
-		Type: "message:new",
-		Payload: map[string]interface{}{
-			"message": models.MessageWithSender{
-				Message: *msg,
-				Sender:  senderPublic,
-			},
-		},
-	}, &c.UserID)
 }
 
 // handleTyping handles typing indicators
@@ -260,18 +349,22 @@ func (c *Client) handleTyping(payload map[string]interface{}, isTyping bool) {
 		return
 	}
 
+	if c.APIKey != nil && !c.APIKey.AllowsConversation(convID) {
+		return
+	}
+
 	eventType := "user:typing_stop"
 	if isTyping {
 		eventType = "user:typing"
 	}
 
-	Hub.BroadcastToConversation(convID, WSMessage{
+	Hub.BroadcastFromUser(convID, c.UserID, WSMessage{
 		Type: eventType,
 		Payload: map[string]interface{}{
 			"conversation_id": convIDStr,
 			"user_id":         c.UserID.Hex(),
 		},
-	}, &c.UserID)
+	})
 }
 
 // handleMessageRead handles read receipts
@@ -287,17 +380,23 @@ func (c *Client) handleMessageRead(payload map[string]interface{}) {
 		return
 	}
 
+	if c.APIKey != nil && !c.APIKey.AllowsConversation(convID) {
+		return
+	}
+
 	if msgIDStr != "" {
 		// Mark specific message as read
 		msgID, err := primitive.ObjectIDFromHex(msgIDStr)
 		if err != nil {
 			return
 		}
-		models.MarkMessageAsRead(msgID, c.UserID)
+		reader, _ := models.FindUserByID(c.UserID)
+		receipt := reader != nil && reader.SendsReadReceipts()
+		models.MarkMessageAsRead(msgID, c.UserID, receipt)
 
-		// Notify sender
+		// Notify sender, unless the reader turned read receipts off
 		msg, _ := models.FindMessageByID(msgID)
-		if msg != nil && msg.SenderID != c.UserID {
+		if receipt && msg != nil && msg.SenderID != c.UserID {
 			Hub.SendToUser(msg.SenderID, WSMessage{
 				Type: "message:status",
 				Payload: map[string]interface{}{
@@ -17,12 +17,15 @@ type WSMessage struct {
 
 // Client represents a connected WebSocket client
 type Client struct {
-	ID       primitive.ObjectID
-	UserID   primitive.ObjectID
-	Conn     WebSocketConn
-	Hub      *WebSocketHub
-	Send     chan []byte
-	LastPing time.Time
+	ID        primitive.ObjectID
+	UserID    primitive.ObjectID
+	SessionID primitive.ObjectID // Login session the connection was opened with; zero for bots
+	Conn      WebSocketConn
+	Hub       *WebSocketHub
+	Send      chan []byte
+	LastPing  time.Time
+	// APIKey is set for bots; they only receive events of the conversations it allows
+	APIKey *models.APIKey
 }
 
 // WebSocketConn interface for WebSocket connection
@@ -43,8 +46,9 @@ type WebSocketHub struct {
 
 // BroadcastMessage for sending to specific users
 type BroadcastMessage struct {
-	UserIDs []primitive.ObjectID
-	Message []byte
+	UserIDs        []primitive.ObjectID
+	ConversationID primitive.ObjectID // Zero for events not tied to a conversation
+	Message        []byte
 }
 
 // Hub is the global WebSocket hub
@@ -99,6 +103,9 @@ func (h *WebSocketHub) Run() {
 				h.mu.RUnlock()
 				if ok {
 					for client := range clients {
+						if !client.receives(message) {
+							continue
+						}
 						select {
 						case client.Send <- message.Message:
 						default:
@@ -114,6 +121,14 @@ func (h *WebSocketHub) Run() {
 	}
 }
 
+// receives reports whether a broadcast should be delivered to the client
+func (c *Client) receives(message BroadcastMessage) bool {
+	if c.APIKey == nil {
+		return true
+	}
+	return !message.ConversationID.IsZero() && c.APIKey.AllowsConversation(message.ConversationID)
+}
+
 // Register adds a client to the hub
 func (h *WebSocketHub) Register(client *Client) {
 	h.register <- client
@@ -124,6 +139,61 @@ func (h *WebSocketHub) Unregister(client *Client) {
 	h.unregister <- client
 }
 
+// DisconnectUser closes every connection of a user
+func (h *WebSocketHub) DisconnectUser(userID primitive.ObjectID) {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients[userID]))
+	for client := range h.clients[userID] {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	// Closing the connection ends the read pump, which unregisters the client
+	for _, client := range clients {
+		client.Conn.Close()
+	}
+}
+
+// DisconnectSession closes the connections opened with any of the given login sessions
+func (h *WebSocketHub) DisconnectSession(sessionIDs ...primitive.ObjectID) {
+	revoked := make(map[primitive.ObjectID]bool, len(sessionIDs))
+	for _, id := range sessionIDs {
+		revoked[id] = true
+	}
+
+	h.mu.RLock()
+	clients := []*Client{}
+	for _, userClients := range h.clients {
+		for client := range userClients {
+			if !client.SessionID.IsZero() && revoked[client.SessionID] {
+				clients = append(clients, client)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	// Closing the connection ends the read pump, which unregisters the client
+	for _, client := range clients {
+		client.Conn.Close()
+	}
+}
+
+// DisconnectAPIKey closes a bot's connections authenticated with the given API key
+func (h *WebSocketHub) DisconnectAPIKey(botID, keyID primitive.ObjectID) {
+	h.mu.RLock()
+	clients := []*Client{}
+	for client := range h.clients[botID] {
+		if client.APIKey != nil && client.APIKey.ID == keyID {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		client.Conn.Close()
+	}
+}
+
 // IsOnline checks if a user is online
 func (h *WebSocketHub) IsOnline(userID primitive.ObjectID) bool {
 	h.mu.RLock()
@@ -183,11 +253,93 @@ func (h *WebSocketHub) BroadcastToConversation(convID primitive.ObjectID, msg WS
 		}
 	}
 
-	h.SendToUsers(userIDs, msg)
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	h.broadcast <- BroadcastMessage{
+		UserIDs:        userIDs,
+		ConversationID: convID,
+		Message:        data,
+	}
 }
 
-// notifyOnlineStatus notifies contacts about user's online status
+// recipientsFromUser returns the members of a conversation who receive a user's activity:
+// everyone except the user and members who have blocked them
+func recipientsFromUser(convID, senderID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	conv, err := models.FindConversationByID(convID)
+	if err != nil || conv == nil {
+		return nil, err
+	}
+
+	blockers, err := models.GetBlockersAmong(senderID, conv.Members)
+	if err != nil {
+		return nil, err
+	}
+	skip := map[primitive.ObjectID]bool{senderID: true}
+	for _, id := range blockers {
+		skip[id] = true
+	}
+
+	userIDs := make([]primitive.ObjectID, 0, len(conv.Members))
+	for _, memberID := range conv.Members {
+		if !skip[memberID] {
+			userIDs = append(userIDs, memberID)
+		}
+	}
+	return userIDs, nil
+}
+
+// BroadcastFromUser sends a user's activity to the other members of a conversation,
+// skipping members who have blocked them
+func (h *WebSocketHub) BroadcastFromUser(convID, senderID primitive.ObjectID, msg WSMessage) {
+	userIDs, err := recipientsFromUser(convID, senderID)
+	if err != nil || len(userIDs) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	h.broadcast <- BroadcastMessage{
+		UserIDs:        userIDs,
+		ConversationID: convID,
+		Message:        data,
+	}
+}
+
+// BroadcastFromUserEach is like BroadcastFromUser, but builds the message separately for
+// each recipient, e.g. to show the sender's profile as that recipient may see it
+func (h *WebSocketHub) BroadcastFromUserEach(convID, senderID primitive.ObjectID, build func(recipientID primitive.ObjectID) WSMessage) {
+	userIDs, err := recipientsFromUser(convID, senderID)
+	if err != nil {
+		return
+	}
+
+	for _, userID := range userIDs {
+		data, err := json.Marshal(build(userID))
+		if err != nil {
+			continue
+		}
+
+		h.broadcast <- BroadcastMessage{
+			UserIDs:        []primitive.ObjectID{userID},
+			ConversationID: convID,
+			Message:        data,
+		}
+	}
+}
+
+// notifyOnlineStatus notifies contacts about user's online status, if they may see it
 func (h *WebSocketHub) notifyOnlineStatus(userID primitive.ObjectID, isOnline bool) {
+	user, err := models.FindUserByID(userID)
+	if err != nil || user == nil {
+		return
+	}
+
 	contacts, err := models.GetContacts(userID)
 	if err != nil {
 		return
@@ -199,6 +351,9 @@ func (h *WebSocketHub) notifyOnlineStatus(userID primitive.ObjectID, isOnline bo
 	}
 
 	for _, contact := range contacts {
+		if !user.ShowsOnlineTo(contact.ID) {
+			continue
+		}
 		h.SendToUser(contact.ID, WSMessage{
 			Type: eventType,
 			Payload: map[string]interface{}{
@@ -48,8 +48,8 @@ export function AddContactModal({ isOpen, onClose }: AddContactModalProps) {
     setError('');
 
     try {
-      await contactsApi.add(searchResult.unique_id);
-      setSuccess('Contact added successfully!');
+      const response = await contactsApi.add(searchResult.unique_id);
+      setSuccess(response.message);
       fetchContacts();
       setTimeout(() => {
         handleClose();
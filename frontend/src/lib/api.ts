@@ -14,30 +14,69 @@ class ApiError extends Error {
   }
 }
 
-async function request<T>(endpoint: string, options: ApiOptions = {}): Promise<T> {
+// CSRF token of the current session, sent with every state-changing request
+let csrfToken: string | null = null;
+
+async function fetchCsrfToken(): Promise<string | null> {
+  const response = await fetch(`${API_URL}/api/auth/csrf`, { credentials: 'include' });
+  if (!response.ok) return null;
+  const body = await response.json().catch(() => ({}));
+  return body.csrf_token || null;
+}
+
+async function request<T>(endpoint: string, options: ApiOptions = {}, retried = false): Promise<T> {
   const { data, ...customConfig } = options;
+  // Uploads let the browser set the multipart content type and boundary
+  const isForm = data instanceof FormData;
 
   const config: RequestInit = {
     method: data ? 'POST' : 'GET',
     credentials: 'include',
+    ...customConfig,
     headers: {
-      'Content-Type': 'application/json',
+      ...(isForm ? {} : { 'Content-Type': 'application/json' }),
+      ...customConfig.headers,
     },
-    ...customConfig,
   };
 
   if (data) {
-    config.body = JSON.stringify(data);
+    config.body = isForm ? data : JSON.stringify(data);
+  }
+
+  const method = (config.method || 'GET').toUpperCase();
+  const unsafe = !['GET', 'HEAD', 'OPTIONS'].includes(method);
+  if (unsafe) {
+    // e.g. after a page reload the token is no longer in memory
+    if (!csrfToken) {
+      csrfToken = await fetchCsrfToken().catch(() => null);
+    }
+    if (csrfToken) {
+      (config.headers as Record<string, string>)['X-CSRF-Token'] = csrfToken;
+    }
   }
 
   const response = await fetch(`${API_URL}${endpoint}`, config);
 
   if (!response.ok) {
     const error = await response.json().catch(() => ({ error: 'Request failed' }));
+
+    // The session changed since the token was fetched; refresh it and try once more
+    if (unsafe && response.status === 403 && error.error === 'Invalid or missing CSRF token' && !retried) {
+      csrfToken = null;
+      return request<T>(endpoint, options, true);
+    }
+
     throw new ApiError(error.error || 'Request failed', response.status);
   }
 
-  return response.json();
+  const body = await response.json();
+
+  // Logins return the new session's token
+  if (body && typeof body.csrf_token === 'string') {
+    csrfToken = body.csrf_token;
+  }
+
+  return body;
 }
 
 export const api = {
@@ -65,31 +104,131 @@ export const authApi = {
   logout: () => api.post<{ message: string }>('/api/auth/logout'),
 
   me: () => api.get<{ user: User }>('/api/auth/me'),
+
+  updateUniqueId: (uniqueId: string) =>
+    api.put<{ message: string; unique_id: string }>('/api/auth/unique-id', { unique_id: uniqueId }),
+};
+
+// Profile API
+export const profileApi = {
+  update: (data: { name?: string; bio?: string; avatar?: '' }) =>
+    api.put<{ message: string; user: User }>('/api/me/profile', data),
+
+  uploadAvatar: (file: File) => {
+    const form = new FormData();
+    form.append('image', file);
+    return api.post<{ message: string; avatar: string; sizes: Record<string, string> }>('/api/me/avatar', form);
+  },
+};
+
+// Privacy API
+export const privacyApi = {
+  get: () => api.get<{ privacy: PrivacySettings }>('/api/me/privacy'),
+
+  update: (data: Partial<PrivacySettings>) =>
+    api.put<{ message: string; privacy: PrivacySettings }>('/api/me/privacy', data),
 };
 
 // Contacts API
 export const contactsApi = {
-  list: () => api.get<{ contacts: User[] }>('/api/contacts'),
+  list: (filters: { favorite?: boolean; list?: string; q?: string; sort?: 'name' | 'added' | 'favorite' } = {}) => {
+    const params = new URLSearchParams();
+    if (filters.favorite) params.set('favorite', 'true');
+    if (filters.list) params.set('list', filters.list);
+    if (filters.q) params.set('q', filters.q);
+    if (filters.sort) params.set('sort', filters.sort);
+    const query = params.toString();
+    return api.get<{ contacts: Contact[] }>(`/api/contacts${query ? `?${query}` : ''}`);
+  },
+
+  update: (id: string, data: { nickname?: string; note?: string; favorite?: boolean; lists?: string[] }) =>
+    api.put<{ message: string; contact: Contact }>(`/api/contacts/${id}`, data),
 
   add: (uniqueId: string) =>
-    api.post<{ message: string; contact: User }>('/api/contacts', { unique_id: uniqueId }),
+    api.post<{ message: string; contact?: User; request?: ContactRequest }>('/api/contacts/requests', {
+      unique_id: uniqueId,
+    }),
+
+  requests: () =>
+    api.get<{ incoming: ContactRequest[]; outgoing: ContactRequest[] }>('/api/contacts/requests'),
+
+  acceptRequest: (id: string) =>
+    api.post<{ message: string; contact: User }>(`/api/contacts/requests/${id}/accept`),
+
+  declineRequest: (id: string) => api.post<{ message: string }>(`/api/contacts/requests/${id}/decline`),
+
+  cancelRequest: (id: string) => api.delete<{ message: string }>(`/api/contacts/requests/${id}`),
 
   remove: (id: string) => api.delete<{ message: string }>(`/api/contacts/${id}`),
 
   search: (uniqueId: string) => api.get<{ user: User }>(`/api/contacts/search?unique_id=${uniqueId}`),
+
+  discover: (query: string, skip = 0, limit = 20) =>
+    api.get<{ users: DiscoveredUser[]; total: number }>(
+      `/api/contacts/discover?q=${encodeURIComponent(query)}&skip=${skip}&limit=${limit}`
+    ),
+};
+
+// Contact lists API
+export const contactListsApi = {
+  list: () => api.get<{ lists: ContactList[] }>('/api/contacts/lists'),
+
+  create: (name: string) => api.post<{ list: ContactList }>('/api/contacts/lists', { name }),
+
+  rename: (id: string, name: string) => api.put<{ message: string }>(`/api/contacts/lists/${id}`, { name }),
+
+  delete: (id: string) => api.delete<{ message: string }>(`/api/contacts/lists/${id}`),
+};
+
+// Contact invite links API
+export const invitesApi = {
+  list: () => api.get<{ invites: ContactInvite[] }>('/api/contacts/invites'),
+
+  create: (data: { max_uses?: number; expires_in?: number }) =>
+    api.post<{ invite: ContactInvite }>('/api/contacts/invites', data),
+
+  revoke: (id: string) => api.delete<{ message: string }>(`/api/contacts/invites/${id}`),
+
+  qrCodeUrl: (id: string, format: 'png' | 'svg' = 'png') =>
+    `${API_URL}/api/contacts/invites/${id}/qr?format=${format}`,
+
+  resolve: (token: string) => api.get<{ user: User }>(`/api/invites/${encodeURIComponent(token)}`),
+
+  accept: (token: string) =>
+    api.post<{ message: string; contact?: User; request?: ContactRequest }>(
+      `/api/invites/${encodeURIComponent(token)}/accept`
+    ),
+};
+
+// Blocked users API
+export const blocksApi = {
+  list: () => api.get<{ blocked: User[] }>('/api/blocks'),
+
+  block: (userId: string) => api.post<{ message: string }>('/api/blocks', { user_id: userId }),
+
+  unblock: (userId: string) => api.delete<{ message: string }>(`/api/blocks/${userId}`),
 };
 
 // Conversations API
 export const conversationsApi = {
   list: () => api.get<{ conversations: Conversation[] }>('/api/conversations'),
 
-  create: (userId: string) =>
-    api.post<{ conversation: Conversation }>('/api/conversations', { user_id: userId }),
+  create: (userId: string, encrypted = false) =>
+    api.post<{ conversation: Conversation }>('/api/conversations', { user_id: userId, encrypted }),
 
   get: (id: string) => api.get<{ conversation: Conversation }>(`/api/conversations/${id}`),
 
   messages: (id: string, skip = 0, limit = 50) =>
     api.get<{ messages: Message[] }>(`/api/conversations/${id}/messages?skip=${skip}&limit=${limit}`),
+
+  deleteMessage: (id: string, messageId: string) =>
+    api.delete<{ message: string }>(`/api/conversations/${id}/messages/${messageId}`),
+
+  pinMessage: (id: string, messageId: string) =>
+    api.post<{ message: string; pinned: boolean }>(`/api/conversations/${id}/messages/${messageId}/pin`),
+
+  unpinMessage: (id: string, messageId: string) =>
+    api.delete<{ message: string; pinned: boolean }>(`/api/conversations/${id}/messages/${messageId}/pin`),
 };
 
 // Groups API
@@ -100,32 +239,175 @@ export const groupsApi = {
   update: (id: string, data: { name?: string; icon?: string }) =>
     api.put<{ message: string; group: Conversation }>(`/api/groups/${id}`, data),
 
+  uploadIcon: (id: string, file: File) => {
+    const form = new FormData();
+    form.append('image', file);
+    return api.post<{ message: string; icon: string; sizes: Record<string, string> }>(`/api/groups/${id}/icon`, form);
+  },
+
   addMember: (id: string, userId: string) =>
     api.post<{ message: string }>(`/api/groups/${id}/members`, { user_id: userId }),
 
   removeMember: (id: string, userId: string) =>
     api.delete<{ message: string }>(`/api/groups/${id}/members/${userId}`),
 
+  promote: (id: string, userId: string, role: 'admin' | 'moderator') =>
+    api.post<{ message: string; role: GroupRole }>(`/api/groups/${id}/members/${userId}/promote`, { role }),
+
+  demote: (id: string, userId: string, role: 'moderator' | 'member' = 'member') =>
+    api.post<{ message: string; role: GroupRole }>(`/api/groups/${id}/members/${userId}/demote`, { role }),
+
+  transferOwnership: (id: string, userId: string) =>
+    api.post<{ message: string }>(`/api/groups/${id}/transfer`, { user_id: userId }),
+
   leave: (id: string) => api.post<{ message: string }>(`/api/groups/${id}/leave`),
 };
 
+// Group invite links API
+export const groupInvitesApi = {
+  list: (groupId: string) => api.get<{ invites: GroupInvite[] }>(`/api/groups/${groupId}/invites`),
+
+  create: (groupId: string, data: { max_uses?: number; expires_in?: number; approval_required?: boolean }) =>
+    api.post<{ invite: GroupInvite }>(`/api/groups/${groupId}/invites`, data),
+
+  revoke: (groupId: string, id: string) => api.delete<{ message: string }>(`/api/groups/${groupId}/invites/${id}`),
+
+  preview: (token: string) =>
+    api.get<{ group: GroupPreview; approval_required: boolean; expires_at?: string }>(
+      `/api/group-invites/${encodeURIComponent(token)}`
+    ),
+
+  join: (token: string, message?: string) =>
+    api.post<{ message: string; group_id?: string; request?: GroupJoinRequest }>(
+      `/api/group-invites/${encodeURIComponent(token)}/join`,
+      { message }
+    ),
+};
+
+// Group join requests API
+export const joinRequestsApi = {
+  list: (groupId: string) => api.get<{ requests: GroupJoinRequest[] }>(`/api/groups/${groupId}/join-requests`),
+
+  approve: (groupId: string, id: string) =>
+    api.post<{ message: string }>(`/api/groups/${groupId}/join-requests/${id}/approve`),
+
+  reject: (groupId: string, id: string) =>
+    api.post<{ message: string }>(`/api/groups/${groupId}/join-requests/${id}/reject`),
+
+  mine: () => api.get<{ requests: GroupJoinRequest[] }>('/api/groups/join-requests/mine'),
+
+  cancel: (id: string) => api.delete<{ message: string }>(`/api/groups/join-requests/${id}`),
+};
+
+// WebSocket API
+export const wsApi = {
+  ticket: () => api.post<{ ticket: string; expires_in: number }>('/api/ws/ticket'),
+};
+
 // Types
 export interface User {
   id: string;
   unique_id: string;
   name: string;
   avatar: string;
+  bio?: string;
+  nickname?: string;
   last_seen?: string;
   is_online?: boolean;
 }
 
+export interface Contact extends User {
+  note?: string;
+  favorite: boolean;
+  lists: string[];
+  added_at: string;
+}
+
+export interface ContactList {
+  id: string;
+  name: string;
+  contact_count: number;
+}
+
+export interface DiscoveredUser extends User {
+  mutual_contacts: number;
+  shared_group: boolean;
+}
+
+export type Discoverability = 'everyone' | 'contacts_of_contacts' | 'nobody';
+
+export type Visibility = 'everyone' | 'contacts' | 'nobody';
+
+export interface PrivacySettings {
+  discoverability: Discoverability;
+  last_seen: Visibility;
+  online: Visibility;
+  profile_photo: Visibility;
+  read_receipts: boolean;
+}
+
+export interface ContactInvite {
+  id: string;
+  token: string;
+  link: string;
+  max_uses?: number;
+  uses: number;
+  expires_at?: string;
+  created_at: string;
+}
+
+export interface ContactRequest {
+  id: string;
+  from_id: string;
+  to_id: string;
+  created_at: string;
+  user?: User;
+}
+
+export interface GroupInvite {
+  id: string;
+  group_id: string;
+  created_by: string;
+  token: string;
+  link: string;
+  max_uses?: number;
+  uses: number;
+  approval_required: boolean;
+  expires_at?: string;
+  created_at: string;
+}
+
+export interface GroupJoinRequest {
+  id: string;
+  group_id: string;
+  user_id: string;
+  invite_id?: string;
+  message?: string;
+  created_at: string;
+  user?: User;
+  group?: GroupPreview;
+}
+
+export interface GroupPreview {
+  id: string;
+  name: string;
+  icon?: string;
+  member_count: number;
+}
+
+export type GroupRole = 'owner' | 'admin' | 'moderator' | 'member';
+
 export interface Conversation {
   id: string;
   type: 'private' | 'group';
   members: string[];
   group_name?: string;
   group_icon?: string;
-  admin?: string;
+  owner?: string;
+  admins?: string[];
+  moderators?: string[];
+  pinned_messages?: string[];
+  encrypted?: boolean;
   created_at: string;
   updated_at: string;
   last_message?: Message;
@@ -138,7 +420,10 @@ export interface Message {
   id: string;
   conversation_id: string;
   sender_id: string;
+  type?: 'text' | 'encrypted';
   content: string;
+  ciphertext?: string;
+  sender_device?: string;
   status: 'sent' | 'delivered' | 'read';
   read_by: string[];
   created_at: string;
@@ -1,4 +1,4 @@
-import { Message } from './api';
+import { Message, wsApi } from './api';
 
 const WS_URL = process.env.NEXT_PUBLIC_WS_URL || 'ws://localhost:8080/ws';
 
@@ -6,14 +6,26 @@ export type WSEventType =
   | 'message:new'
   | 'message:sent'
   | 'message:status'
+  | 'message:deleted'
+  | 'message:pinned'
+  | 'message:unpinned'
   | 'user:typing'
   | 'user:typing_stop'
   | 'user:online'
   | 'user:offline'
+  | 'user:updated'
+  | 'contact:request'
+  | 'contact:accepted'
+  | 'contact:request_cancelled'
   | 'group:created'
   | 'group:updated'
   | 'group:member_added'
   | 'group:member_removed'
+  | 'group:role_changed'
+  | 'group:owner_changed'
+  | 'group:join_request'
+  | 'group:join_request_resolved'
+  | 'group:join_rejected'
   | 'pong'
   | 'error';
 
@@ -33,15 +45,16 @@ class WebSocketClient {
   private handlers: Map<WSEventType, Set<MessageHandler>> = new Map();
   private connectionHandlers: Set<(connected: boolean) => void> = new Set();
 
-  connect(token?: string): Promise<void> {
-    return new Promise((resolve, reject) => {
-      if (this.ws?.readyState === WebSocket.OPEN) {
-        resolve();
-        return;
-      }
+  async connect(): Promise<void> {
+    if (this.ws?.readyState === WebSocket.OPEN) {
+      return;
+    }
+
+    // Each connection needs a fresh single-use ticket
+    const { ticket } = await wsApi.ticket();
 
-      const url = token ? `${WS_URL}?token=${token}` : WS_URL;
-      this.ws = new WebSocket(url);
+    return new Promise((resolve, reject) => {
+      this.ws = new WebSocket(`${WS_URL}?ticket=${encodeURIComponent(ticket)}`);
 
       this.ws.onopen = () => {
         console.log('WebSocket connected');
@@ -100,7 +113,9 @@ class WebSocketClient {
       this.reconnectAttempts++;
       const delay = this.reconnectDelay * Math.pow(2, this.reconnectAttempts - 1);
       console.log(`Attempting to reconnect in ${delay}ms...`);
-      setTimeout(() => this.connect(), delay);
+      setTimeout(() => {
+        this.connect().catch((err) => console.error('Reconnect failed:', err));
+      }, delay);
     }
   }
 
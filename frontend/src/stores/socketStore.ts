@@ -8,7 +8,7 @@ interface SocketState {
   isConnecting: boolean;
   
   // Actions
-  connect: (token?: string) => Promise<void>;
+  connect: () => Promise<void>;
   disconnect: () => void;
 }
 
@@ -16,7 +16,7 @@ export const useSocketStore = create<SocketState>((set, get) => ({
   isConnected: false,
   isConnecting: false,
 
-  connect: async (token) => {
+  connect: async () => {
     if (get().isConnected || get().isConnecting) return;
     
     set({ isConnecting: true });
@@ -25,7 +25,7 @@ export const useSocketStore = create<SocketState>((set, get) => ({
       // Setup event handlers before connecting
       setupSocketHandlers();
       
-      await wsClient.connect(token);
+      await wsClient.connect();
       set({ isConnected: true, isConnecting: false });
     } catch (error) {
       console.error('Failed to connect WebSocket:', error);
@@ -104,6 +104,17 @@ function setupSocketHandlers() {
     const { user_id } = msg.payload as { user_id: string };
     chatStore.setUserOnline(user_id, false);
   });
+
+  // Profile changes of contacts and group members
+  wsClient.on('user:updated', () => {
+    chatStore.fetchContacts();
+    chatStore.fetchConversations();
+  });
+
+  // Contact request accepted
+  wsClient.on('contact:accepted', () => {
+    chatStore.fetchContacts();
+  });
 }
 
 function playNotificationSound() {